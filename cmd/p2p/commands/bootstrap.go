@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type BootstrapCommand struct {
+	NodeOptions `group:"Node Options"`
+}
+
+// Execute implements flags.Commander interface
+func (c *BootstrapCommand) Execute(args []string) error {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	// bootstrap node serves DHT requests of other nodes, so DHT server mode can't be turned off by command line, and
+	// value from config is ignored
+	if !c.DHTServer.Or(true) {
+		return errors.New("bootstrap node always runs DHT in server mode, --dht-server=false is not allowed")
+	}
+	cfg.DHTServer = true
+
+	ctx, cancel := context.WithCancel(createCtrlCContext())
+	defer cancel()
+
+	node, err := c.newNode(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cErr := node.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}()
+
+	ms, err := c.startMetrics(cfg, node)
+	if err != nil {
+		return err
+	}
+	if ms != nil {
+		defer func() {
+			if cErr := ms.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	ctl, err := c.startControl(ctx, cfg, node, cancel)
+	if err != nil {
+		return err
+	}
+	if ctl != nil {
+		defer func() {
+			if cErr := ctl.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	fmt.Println("Bootstrap node started:", node.ID().Pretty())
+	for _, addr := range node.Addrs() {
+		fmt.Printf("Bootstrap address: %v/p2p/%v\n", addr, node.ID().Pretty())
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
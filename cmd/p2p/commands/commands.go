@@ -7,11 +7,14 @@ import (
 )
 
 type RootCommands struct {
-	Version func()         `short:"v" long:"version"  description:"Print the version of tool and exit."`
-	Socks5  Socks5Command  `command:"socks5"          description:"Create p2p service that acts like socks5 server."`
-	Listen  ListenCommand  `command:"listen"          description:"Create p2p service and forward connections made to remote <target-address>."`
-	Forward ForwardCommand `command:"forward"         description:"Forward connections made to local <listen-address> to p2p <target-address>."`
-	KeyGen  KeyGenCommand  `command:"keygen"          description:"Generates identity private key."`
+	Version     func()             `short:"v" long:"version"  description:"Print the version of tool and exit."`
+	Socks5      Socks5Command      `command:"socks5"          description:"Create p2p service that acts like socks5 server."`
+	Listen      ListenCommand      `command:"listen"          description:"Create p2p service and forward connections made to remote <target-address>."`
+	Forward     ForwardCommand     `command:"forward"         description:"Forward connections made to local <listen-address> to p2p <target-address>."`
+	Bootstrap   BootstrapCommand   `command:"bootstrap"       description:"Run DHT server node that can be used as bootstrap peer by other nodes."`
+	KeyGen      KeyGenCommand      `command:"keygen"          description:"Generates identity private key."`
+	SwarmKeyGen SwarmKeyGenCommand `command:"swarmkeygen"     description:"Generates private network pre-shared key."`
+	Ctl         CtlCommand         `command:"ctl"             description:"Control running node via its --control-socket."`
 }
 
 var Root RootCommands
@@ -2,22 +2,247 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/config"
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/flag"
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
 )
 
 func createCtrlCContext() context.Context {
+	return createShutdownContext(os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+}
+
+// createReloadableCtrlCContext is like createCtrlCContext, but SIGHUP is left to the command to reload its config.
+func createReloadableCtrlCContext() context.Context {
+	return createShutdownContext(os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+}
+
+func createShutdownContext(sig ...os.Signal) context.Context {
 	fmt.Println("Press Ctrl-C to exit...")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+		signal.Notify(sigChan, sig...)
 		<-sigChan
 		cancel()
 	}()
 
 	return ctx
 }
+
+// onSignal calls `f` every time one of the signals is received until context is done.
+func onSignal(ctx context.Context, f func(), sig ...os.Signal) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, sig...)
+
+	go func() {
+		defer signal.Stop(sigChan)
+
+		for {
+			select {
+			case <-sigChan:
+				f()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ClientPeersOptions are options of the commands that accept connections from authorized client peers.
+type ClientPeersOptions struct {
+	ClientAddresses []flag.PeerAddress `long:"client-address"   description:"Client p2p address or peer ID to accept connections from (can be repeated)."`
+	AuthorizedPeers string             `long:"authorized-peers" description:"File with authorized client peers, one per line: <p2p-address-or-peer-id> [label=<label>] [targets=<target>,...]. Reloaded on SIGHUP."`
+}
+
+// load returns authorized client peers specified by command line options, if none specified, then peers from config
+// are used.
+func (o *ClientPeersOptions) load(cfg config.ClientPeers) ([]acl.Peer, error) {
+	var peers []acl.Peer
+	authorizedPeersFile := o.AuthorizedPeers
+
+	if len(o.ClientAddresses) == 0 && authorizedPeersFile == "" {
+		for i := range cfg.Peers {
+			peers = append(peers, cfg.Peers[i].AsPeer())
+		}
+		authorizedPeersFile = cfg.AuthorizedPeers
+	} else {
+		for i := range o.ClientAddresses {
+			peers = append(peers, acl.Peer{AddrInfo: o.ClientAddresses[i].AsAddrInfo()})
+		}
+	}
+
+	if authorizedPeersFile != "" {
+		filePeers, err := acl.ReadFile(authorizedPeersFile)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, filePeers...)
+	}
+
+	if len(peers) == 0 {
+		return nil, errors.New("no authorized peers: specify at least one --client-address or --authorized-peers file")
+	}
+
+	return peers, nil
+}
+
+// reloadClientPeersOnSIGHUP reloads client peers on SIGHUP. Already established sessions are not affected.
+func reloadClientPeersOnSIGHUP(ctx context.Context, clientPeers *acl.Peers, load func() ([]acl.Peer, error)) {
+	onSignal(ctx, func() {
+		peers, err := load()
+		if err != nil {
+			fmt.Println("Failed to reload authorized peers:", err)
+			return
+		}
+
+		clientPeers.Replace(peers...)
+		fmt.Println("Authorized peers reloaded:", clientPeers.Len())
+	}, syscall.SIGHUP)
+}
+
+// reloadDestinationRulesOnSIGHUP reloads destination rules on SIGHUP. Already established sessions are not affected.
+func reloadDestinationRulesOnSIGHUP(ctx context.Context, destRules *acl.DestinationRules, load func() ([]acl.DestinationRule, error)) {
+	onSignal(ctx, func() {
+		rules, err := load()
+		if err != nil {
+			fmt.Println("Failed to reload destination rules:", err)
+			return
+		}
+
+		destRules.Replace(rules...)
+		fmt.Println("Destination rules reloaded:", destRules.Len())
+	}, syscall.SIGHUP)
+}
+
+// advertise advertises node under the rendezvous names.
+func advertise(node *p2p.Node, rendezvous []string) {
+	node.Advertise(rendezvous...)
+	for _, r := range rendezvous {
+		fmt.Printf("Advertising node under rendezvous %q\n", r)
+	}
+}
+
+// AccessLogOptions are options of the commands that write access log of forwarding sessions.
+type AccessLogOptions struct {
+	AccessLog string `long:"access-log" description:"File to append JSON access log record of every session to, '-' for standard output."`
+}
+
+// BufferOptions are options of the commands that copy session data.
+type BufferOptions struct {
+	BufferSize flag.ByteSize `long:"buffer-size" description:"Size of pooled buffers used to copy session data, e.g. 16k, at most 1M (default: 32k)."`
+}
+
+// bufferSize returns buffer size specified by command line option or config, zero means default size. Sizes larger
+// than p2p.MaxBufferSize are rejected.
+func (o *BufferOptions) bufferSize(cfg *config.Config) (int, error) {
+	size := o.BufferSize
+	if size == 0 {
+		size = cfg.BufferSize
+	}
+	if size > p2p.MaxBufferSize {
+		return 0, fmt.Errorf("buffer size %v exceeds maximum of %v bytes", size.Bytes(), p2p.MaxBufferSize)
+	}
+	return size.Bytes(), nil
+}
+
+// open opens access log specified by command line option or config, otherwise nil logger is returned.
+func (o *AccessLogOptions) open(cfg *config.Config) (*accesslog.Logger, error) {
+	path := o.AccessLog
+	if path == "" {
+		path = cfg.AccessLog
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	l, err := accesslog.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %v", err)
+	}
+	return l, nil
+}
+
+// RateLimitOptions are bandwidth limits of the commands that forward sessions, upload is the rate of bytes sent to p2p
+// streams and download is the rate of bytes received from them.
+type RateLimitOptions struct {
+	UploadLimit          flag.ByteRate `long:"upload-limit"           description:"Upload limit of all sessions in bytes per second, e.g. 512k or 10M."`
+	DownloadLimit        flag.ByteRate `long:"download-limit"         description:"Download limit of all sessions in bytes per second."`
+	PeerUploadLimit      flag.ByteRate `long:"peer-upload-limit"      description:"Upload limit of all sessions with the same peer in bytes per second."`
+	PeerDownloadLimit    flag.ByteRate `long:"peer-download-limit"    description:"Download limit of all sessions with the same peer in bytes per second."`
+	SessionUploadLimit   flag.ByteRate `long:"session-upload-limit"   description:"Upload limit of every session in bytes per second."`
+	SessionDownloadLimit flag.ByteRate `long:"session-download-limit" description:"Download limit of every session in bytes per second."`
+}
+
+// limiter returns rate limiter with limits specified by command line options, if some limit is not specified, then
+// value from config is used. Nil is returned if nothing is limited.
+func (o *RateLimitOptions) limiter(cfg config.RateLimit) *ratelimit.Limiter {
+	global := limits(o.UploadLimit, o.DownloadLimit, cfg.Global)
+	perPeer := limits(o.PeerUploadLimit, o.PeerDownloadLimit, cfg.Peer)
+	perSession := limits(o.SessionUploadLimit, o.SessionDownloadLimit, cfg.Session)
+	if global.IsZero() && perPeer.IsZero() && perSession.IsZero() {
+		return nil
+	}
+
+	fmt.Printf("Rate limits (bytes/s): global %v, per peer %v, per session %v\n",
+		formatLimits(global), formatLimits(perPeer), formatLimits(perSession))
+	return ratelimit.New(global, perPeer, perSession)
+}
+
+func limits(upload, download flag.ByteRate, cfg config.Limits) ratelimit.Limits {
+	if upload == 0 {
+		upload = cfg.Upload
+	}
+	if download == 0 {
+		download = cfg.Download
+	}
+	return ratelimit.Limits{Upload: upload.BytesPerSecond(), Download: download.BytesPerSecond()}
+}
+
+func formatLimits(l ratelimit.Limits) string {
+	format := func(n int64) string {
+		if n <= 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("up %v/down %v", format(l.Upload), format(l.Download))
+}
+
+// SessionLimitOptions are caps of concurrent sessions of the commands that forward sessions.
+type SessionLimitOptions struct {
+	MaxSessions         int           `long:"max-sessions"          description:"Maximum number of concurrent sessions of every service (default: unlimited)."`
+	MaxPeerSessions     int           `long:"max-peer-sessions"     description:"Maximum number of concurrent sessions of the same client peer with every service (default: unlimited)."`
+	SessionQueueTimeout time.Duration `long:"session-queue-timeout" description:"How long excess session waits for free slot, excess sessions are rejected immediately if not specified."`
+}
+
+// limits returns session limits specified by command line options, if some limit is not specified, then value from
+// config is used.
+func (o *SessionLimitOptions) limits(cfg config.SessionLimits) connlimit.Limits {
+	limits := connlimit.Limits{
+		MaxSessions:     o.MaxSessions,
+		MaxPeerSessions: o.MaxPeerSessions,
+		QueueTimeout:    o.SessionQueueTimeout,
+	}
+	if limits.MaxSessions == 0 {
+		limits.MaxSessions = cfg.MaxSessions
+	}
+	if limits.MaxPeerSessions == 0 {
+		limits.MaxPeerSessions = cfg.MaxPeerSessions
+	}
+	if limits.QueueTimeout == 0 {
+		limits.QueueTimeout = cfg.QueueTimeout
+	}
+	return limits
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/flag"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is a declarative configuration of all commands. Values from the command line options override values from
+// the config.
+type Config struct {
+	Identity          string               `yaml:"identity"`            // identity key file
+	Bootstrap         []flag.PeerAddress   `yaml:"bootstrap"`           // additional bootstrap peers
+	NoPublicBootstrap bool                 `yaml:"no_public_bootstrap"` // do not use public bootstrap peers
+	DHTServer         bool                 `yaml:"dht_server"`          // run DHT in server mode
+	SwarmKey          string               `yaml:"swarm_key"`           // private network pre-shared key file
+	P2PListen         []flag.MultiAddress  `yaml:"p2p_listen"`          // p2p listen addresses
+	Transports        []flag.TransportType `yaml:"transports"`          // enabled transports
+	NoNATPortMap      bool                 `yaml:"no_nat_port_map"`     // do not open p2p port using UPnP/NAT-PMP
+	NoRelay           bool                 `yaml:"no_relay"`            // disable circuit relay
+	NoAutoRelay       bool                 `yaml:"no_auto_relay"`       // do not use or advertise public relays
+	Relays            []flag.PeerAddress   `yaml:"relays"`              // relay peers to keep connections to
+	RelayOnly         bool                 `yaml:"relay_only"`          // be reachable only via relays
+	RelayHop          bool                 `yaml:"relay_hop"`           // act as circuit relay
+	RelayHopLimit     int                  `yaml:"relay_hop_limit"`     // maximum number of relayed connections
+	ControlSocket     string               `yaml:"control_socket"`      // unix socket to serve control API on
+	MetricsAddress    flag.MultiAddress    `yaml:"metrics_address"`     // address to serve Prometheus metrics on
+	AccessLog         string               `yaml:"access_log"`          // file to write JSON access log to, "-" for stdout
+	RateLimit         RateLimit            `yaml:"rate_limit"`          // bandwidth limits of forward, listen and socks5 sessions
+	SessionLimits     SessionLimits        `yaml:"session_limits"`      // caps of concurrent forward, listen and socks5 sessions
+	BufferSize        flag.ByteSize        `yaml:"buffer_size"`         // size of pooled session copy buffers
+	Listen            Listen               `yaml:"listen"`              // listen command configuration
+	Forward           Forward              `yaml:"forward"`             // forward command configuration
+	Socks5            Socks5               `yaml:"socks5"`              // socks5 command configuration
+}
+
+// ClientPeers describes peers authorized to use p2p service.
+type ClientPeers struct {
+	AuthorizedPeers string `yaml:"authorized_peers"` // authorized peers file
+	Peers           []Peer `yaml:"peers"`            // authorized peers
+}
+
+// Peer is an authorized peer.
+type Peer struct {
+	Address flag.PeerAddress `yaml:"address"`
+	Label   string           `yaml:"label"`
+	Targets []string         `yaml:"targets"`
+}
+
+// Listen is a listen command configuration.
+type Listen struct {
+	ClientPeers `yaml:",inline"`
+	Services    []Service     `yaml:"services"`
+	Rendezvous  []string      `yaml:"rendezvous"`   // rendezvous names to advertise node under
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // timeout after which idle session is closed
+	MaxLifetime time.Duration `yaml:"max_lifetime"` // maximum lifetime of the session
+}
+
+// Service is a named target service.
+type Service struct {
+	Name   string            `yaml:"name"` // empty name means default service
+	Target flag.MultiAddress `yaml:"target"`
+}
+
+// Forward is a forward command configuration.
+type Forward struct {
+	Forwards []ForwardMapping `yaml:"forwards"`
+}
+
+// ForwardMapping describes forwarding from local listen address to p2p target.
+type ForwardMapping struct {
+	Listen     flag.MultiAddress   `yaml:"listen"`
+	Target     flag.MultiAddress   `yaml:"target"`
+	Rendezvous string              `yaml:"rendezvous"` // rendezvous name of the target peer, used instead of target
+	Type       flag.P2PServiceType `yaml:"type"`       // defaults to portforwarder
+	Service    string              `yaml:"service"`    // target portforwarder service name, empty means default service
+
+	UDPIdleTimeout time.Duration `yaml:"udp_idle_timeout"` // timeout after which idle UDP session is closed
+	UnixSocketMode os.FileMode   `yaml:"unix_socket_mode"` // permissions of unix socket file for unix listen address
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`     // timeout after which idle TCP or unix socket session is closed
+	MaxLifetime    time.Duration `yaml:"max_lifetime"`     // maximum lifetime of the session
+}
+
+// Socks5 is a socks5 command configuration.
+type Socks5 struct {
+	ClientPeers          `yaml:",inline"`
+	Rendezvous           []string      `yaml:"rendezvous"`             // rendezvous names to advertise node under
+	DrainTimeout         time.Duration `yaml:"drain_timeout"`          // how long to wait on exit for active sessions to finish
+	BindTimeout          time.Duration `yaml:"bind_timeout"`           // how long BIND request waits for inbound connection
+	IdleTimeout          time.Duration `yaml:"idle_timeout"`           // timeout after which idle session is closed
+	DestinationRules     []string      `yaml:"destination_rules"`      // destination rules checked in order
+	DestinationRulesFile string        `yaml:"destination_rules_file"` // file with destination rules
+	DNS                  DNS           `yaml:"dns"`                    // resolution of destination names
+}
+
+// DNS describes how destination domain names are resolved.
+type DNS struct {
+	Servers []string          `yaml:"servers"` // DNS servers for names not matching any rule, empty means system resolver
+	Rules   []DNSRule         `yaml:"rules"`   // split-horizon rules
+	Hosts   map[string]string `yaml:"hosts"`   // static host name to IP address overrides
+	Timeout time.Duration     `yaml:"timeout"` // timeout of single name resolution
+}
+
+// DNSRule makes names matching the domain suffix resolved by the DNS servers.
+type DNSRule struct {
+	Domain  string   `yaml:"domain"`
+	Servers []string `yaml:"servers"`
+}
+
+// RateLimit describes bandwidth limits of all sessions, sessions with the same peer and every session.
+type RateLimit struct {
+	Global  Limits `yaml:"global"`
+	Peer    Limits `yaml:"peer"`
+	Session Limits `yaml:"session"`
+}
+
+// Limits are upload (sent to p2p stream) and download (received from p2p stream) limits, zero means unlimited.
+type Limits struct {
+	Upload   flag.ByteRate `yaml:"upload"`
+	Download flag.ByteRate `yaml:"download"`
+}
+
+// SessionLimits are caps of concurrent sessions of every service, zero means unlimited.
+type SessionLimits struct {
+	MaxSessions     int           `yaml:"max_sessions"`      // per service
+	MaxPeerSessions int           `yaml:"max_peer_sessions"` // per client peer of listen service
+	QueueTimeout    time.Duration `yaml:"queue_timeout"`     // zero rejects excess sessions immediately
+}
+
+// Load reads config from the YAML file. Empty config is returned if path is empty.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(bytes, cfg); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface, it rejects peer with empty list of targets, because only peer
+// without targets key is allowed to access any target.
+func (p *Peer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Peer
+	if err := unmarshal((*plain)(p)); err != nil {
+		return err
+	}
+
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	if _, ok := keys["targets"]; ok || len(p.Targets) > 0 {
+		if err := acl.CheckTargets(p.Targets); err != nil {
+			return fmt.Errorf("peer %v: %v", p.Address.AsAddrInfo().ID.Pretty(), err)
+		}
+	}
+	return nil
+}
+
+// AsPeer returns acl.Peer
+func (p *Peer) AsPeer() acl.Peer {
+	return acl.Peer{
+		AddrInfo: p.Address.AsAddrInfo(),
+		Label:    p.Label,
+		Targets:  p.Targets,
+	}
+}
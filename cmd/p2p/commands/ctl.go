@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/control"
+)
+
+type CtlCommand struct {
+	ControlSocket string `long:"control-socket" required:"true" description:"Unix socket of the running node control API."`
+
+	Peers         CtlPeersCommand         `command:"peers"          description:"List connected peers."`
+	Forwards      CtlForwardsCommand      `command:"forwards"       description:"List running forwarders."`
+	AddForward    CtlAddForwardCommand    `command:"add-forward"    description:"Start new forwarder."`
+	RemoveForward CtlRemoveForwardCommand `command:"remove-forward" description:"Stop forwarder started with add-forward."`
+	Services      CtlServicesCommand      `command:"services"       description:"List p2p services exposed by the node."`
+	Sessions      CtlSessionsCommand      `command:"sessions"       description:"List active forwarding sessions."`
+	Shutdown      CtlShutdownCommand      `command:"shutdown"       description:"Stop the node."`
+}
+
+// ctlRequestTimeout is the timeout of the single control API request.
+const ctlRequestTimeout = time.Minute
+
+// ctl calls control API of the node specified by ctl command options.
+func ctl(f func(ctx context.Context, c *control.Client) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ctlRequestTimeout)
+	defer cancel()
+
+	return f(ctx, control.NewClient(Root.Ctl.ControlSocket))
+}
+
+// printTable prints tab separated rows as table.
+func printTable(header string, rows []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, header)
+	for _, row := range rows {
+		_, _ = fmt.Fprintln(w, row)
+	}
+	return w.Flush()
+}
+
+type CtlPeersCommand struct{}
+
+// Execute implements flags.Commander interface
+func (c *CtlPeersCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		peers, err := client.Peers(ctx)
+		if err != nil {
+			return err
+		}
+
+		rows := make([]string, 0, len(peers))
+		for _, p := range peers {
+			rows = append(rows, fmt.Sprintf("%s\t%s", p.ID, strings.Join(p.Addrs, ", ")))
+		}
+		return printTable("PEER\tADDRESSES", rows)
+	})
+}
+
+type CtlForwardsCommand struct{}
+
+// Execute implements flags.Commander interface
+func (c *CtlForwardsCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		forwards, err := client.Forwards(ctx)
+		if err != nil {
+			return err
+		}
+
+		rows := make([]string, 0, len(forwards))
+		for _, f := range forwards {
+			rows = append(rows, fmt.Sprintf("%d\t%s\t%s\t%s\t%d", f.ID, f.Listen, f.Target, f.Protocol, f.Sessions))
+		}
+		return printTable("ID\tLISTEN\tTARGET\tPROTOCOL\tSESSIONS", rows)
+	})
+}
+
+type CtlAddForwardCommand struct {
+	ListenAddress     string `long:"listen-address"    required:"true"         description:"Listen address to accept incoming connections."`
+	TargetAddress     string `long:"target-address"                            description:"Target p2p address to forward connections to."`
+	TargetRendezvous  string `long:"target-rendezvous"                         description:"Rendezvous name the target peer is advertised under, used instead of --target-address."`
+	TargetServiceType string `long:"target-service"    default:"portforwarder" description:"Target service type (socks5, portforwarder)."`
+	ServiceName       string `long:"service"                                   description:"Name of the target portforwarder service, default service is used if not specified."`
+}
+
+// Execute implements flags.Commander interface
+func (c *CtlAddForwardCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		f, err := client.AddForward(ctx, control.ForwardRequest{
+			Listen:     c.ListenAddress,
+			Target:     c.TargetAddress,
+			Rendezvous: c.TargetRendezvous,
+			Type:       c.TargetServiceType,
+			Service:    c.ServiceName,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Forward %d started: connections made to %v will be forwarded to %v (%v)\n", f.ID, f.Listen, f.Target, f.Protocol)
+		return nil
+	})
+}
+
+type CtlRemoveForwardCommand struct {
+	Args struct {
+		ID int `positional-arg-name:"id" description:"Forward ID"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute implements flags.Commander interface
+func (c *CtlRemoveForwardCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		if err := client.RemoveForward(ctx, c.Args.ID); err != nil {
+			return err
+		}
+
+		fmt.Printf("Forward %d stopped\n", c.Args.ID)
+		return nil
+	})
+}
+
+type CtlServicesCommand struct{}
+
+// Execute implements flags.Commander interface
+func (c *CtlServicesCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		services, err := client.Services(ctx)
+		if err != nil {
+			return err
+		}
+
+		rows := make([]string, 0, len(services))
+		for _, s := range services {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s", s.Type, s.Name, s.Protocol, s.Target))
+		}
+		return printTable("TYPE\tNAME\tPROTOCOL\tTARGET", rows)
+	})
+}
+
+type CtlSessionsCommand struct{}
+
+// Execute implements flags.Commander interface
+func (c *CtlSessionsCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		sessions, err := client.Sessions(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		rows := make([]string, 0, len(sessions))
+		for _, s := range sessions {
+			duration := now.Sub(s.Started).Truncate(time.Second)
+			rows = append(rows, fmt.Sprintf("%d\t%s\t%s\t%s\t%v", s.ID, s.Service, s.Peer, s.LocalAddr, duration))
+		}
+		return printTable("ID\tSERVICE\tPEER\tLOCAL ADDRESS\tDURATION", rows)
+	})
+}
+
+type CtlShutdownCommand struct{}
+
+// Execute implements flags.Commander interface
+func (c *CtlShutdownCommand) Execute(args []string) error {
+	return ctl(func(ctx context.Context, client *control.Client) error {
+		if err := client.Shutdown(ctx); err != nil {
+			return err
+		}
+
+		fmt.Println("Node is shutting down")
+		return nil
+	})
+}
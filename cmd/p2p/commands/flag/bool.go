@@ -0,0 +1,34 @@
+package flag
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Bool is a boolean option which remembers whether it was set on the command line, so it can override value from the
+// config file in both directions, e.g. --no-relay=false. Option must be tagged with optional:"yes" and
+// optional-value:"true" to be set without argument.
+type Bool struct {
+	value bool
+	set   bool
+}
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (b *Bool) UnmarshalFlag(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean value '%v', expected true or false", value)
+	}
+
+	b.value, b.set = v, true
+
+	return nil
+}
+
+// Or returns option value if it was set, otherwise the default value.
+func (b Bool) Or(def bool) bool {
+	if b.set {
+		return b.value
+	}
+	return def
+}
@@ -0,0 +1,72 @@
+package flag
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+}
+
+// parseBytes parses number of bytes with optional k, M or G suffix (binary units), values that overflow int64 are
+// rejected.
+func parseBytes(value string) (int64, bool) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	num, unit := s, ""
+	if i := strings.IndexAny(s, "kmg"); i >= 0 {
+		num, unit = s[:i], s[i:]
+	}
+
+	mul, ok := byteUnits[unit]
+	n, err := strconv.ParseInt(num, 10, 64)
+	if !ok || err != nil || n < 0 || n > math.MaxInt64/mul {
+		return 0, false
+	}
+	return n * mul, true
+}
+
+// ByteRate is a rate in bytes per second, e.g. 512k or 10M (binary units).
+type ByteRate int64
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (r *ByteRate) UnmarshalFlag(value string) error {
+	n, ok := parseBytes(value)
+	if !ok {
+		return fmt.Errorf("invalid byte rate '%v', expected number of bytes per second with optional k, M or G suffix", value)
+	}
+
+	*r = ByteRate(n)
+
+	return nil
+}
+
+// BytesPerSecond returns rate in bytes per second.
+func (r ByteRate) BytesPerSecond() int64 {
+	return int64(r)
+}
+
+// ByteSize is a size in bytes, e.g. 16k or 1M (binary units).
+type ByteSize int64
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (s *ByteSize) UnmarshalFlag(value string) error {
+	n, ok := parseBytes(value)
+	if !ok {
+		return fmt.Errorf("invalid size '%v', expected number of bytes with optional k, M or G suffix", value)
+	}
+
+	*s = ByteSize(n)
+
+	return nil
+}
+
+// Bytes returns size in bytes.
+func (s ByteSize) Bytes() int {
+	return int(s)
+}
@@ -0,0 +1,39 @@
+package flag
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{value: "0", want: 0, ok: true},
+		{value: "512", want: 512, ok: true},
+		{value: "16k", want: 16 << 10, ok: true},
+		{value: " 10M ", want: 10 << 20, ok: true},
+		{value: "2G", want: 2 << 30, ok: true},
+		{value: strconv.FormatInt(math.MaxInt64, 10), want: math.MaxInt64, ok: true},
+		{value: "8589934591G", want: 8589934591 << 30, ok: true},
+		{value: "8589934592G"},
+		{value: "9223372036854775807k"},
+		{value: "9223372036854775808"},
+		{value: "-1k"},
+		{value: "1kb"},
+		{value: "k"},
+		{value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseBytes(tt.value)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseBytes(%q) = %v, %v, expected %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
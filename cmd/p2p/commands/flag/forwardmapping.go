@@ -0,0 +1,79 @@
+package flag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/listener"
+	"github.com/multiformats/go-multiaddr"
+)
+
+type ForwardMapping struct {
+	listenAddr  multiaddr.Multiaddr
+	targetAddr  multiaddr.Multiaddr
+	serviceName string
+}
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (a *ForwardMapping) UnmarshalFlag(value string) (err error) {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid mapping '%v', expected <listen-address>=<target-address>[/<service>]", value)
+	}
+
+	if a.listenAddr, err = multiaddr.NewMultiaddr(kv[0]); err != nil {
+		return err
+	}
+
+	a.targetAddr, a.serviceName, err = parseTargetWithService(kv[1])
+	return
+}
+
+// ListenAddr returns local address to accept connections on
+func (a *ForwardMapping) ListenAddr() multiaddr.Multiaddr {
+	return a.listenAddr
+}
+
+// TargetAddr returns target p2p address to forward connections to
+func (a *ForwardMapping) TargetAddr() multiaddr.Multiaddr {
+	return a.targetAddr
+}
+
+// ServiceName returns name of the target service, empty for default service
+func (a *ForwardMapping) ServiceName() string {
+	return a.serviceName
+}
+
+// parseTargetWithService parses target p2p address optionally followed by service name, e.g. /p2p/QmPeer/ssh. Service
+// name is split off explicitly, because names like http or https are valid multiaddress protocols themselves.
+func parseTargetWithService(value string) (multiaddr.Multiaddr, string, error) {
+	addr, serviceName := value, ""
+	if !endsWithPeerID(addr) {
+		if idx := strings.LastIndex(value, "/"); idx >= 0 {
+			addr, serviceName = value[:idx], value[idx+1:]
+		}
+		if !endsWithPeerID(addr) {
+			return nil, "", fmt.Errorf("invalid target address '%v', expected <p2p-address>[/<service>], e.g. /p2p/QmPeer/ssh", value)
+		}
+		if err := listener.ValidateServiceName(serviceName); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ma, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ma, serviceName, nil
+}
+
+// endsWithPeerID returns true if the last component of the address is p2p peer ID.
+func endsWithPeerID(addr string) bool {
+	idx := strings.LastIndex(addr, "/")
+	if idx < 0 {
+		return false
+	}
+	prefix := addr[:idx]
+	return strings.HasSuffix(prefix, "/p2p") || strings.HasSuffix(prefix, "/ipfs")
+}
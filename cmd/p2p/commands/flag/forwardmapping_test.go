@@ -0,0 +1,80 @@
+package flag
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+const testPeerAddr = "/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWNTaN849ESU3aY35hYJ5bL8aZALk4gVPiZUa18T4eoNCH"
+
+func TestParseTargetWithService(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		addr    string
+		service string
+		wantErr bool
+	}{
+		{name: "default service", value: testPeerAddr, addr: testPeerAddr},
+		{name: "service", value: testPeerAddr + "/ssh", addr: testPeerAddr, service: "ssh"},
+		{name: "http service", value: testPeerAddr + "/http", addr: testPeerAddr, service: "http"},
+		{name: "https service", value: testPeerAddr + "/https", addr: testPeerAddr, service: "https"},
+		{name: "ws service", value: testPeerAddr + "/ws", addr: testPeerAddr, service: "ws"},
+		{name: "wss service", value: testPeerAddr + "/wss", addr: testPeerAddr, service: "wss"},
+		{
+			name:  "bare peer address",
+			value: "/p2p/12D3KooWNTaN849ESU3aY35hYJ5bL8aZALk4gVPiZUa18T4eoNCH/http",
+			addr:  "/p2p/12D3KooWNTaN849ESU3aY35hYJ5bL8aZALk4gVPiZUa18T4eoNCH", service: "http",
+		},
+		{
+			name:  "ipfs peer address",
+			value: "/ipfs/12D3KooWNTaN849ESU3aY35hYJ5bL8aZALk4gVPiZUa18T4eoNCH/ws",
+			addr:  "/p2p/12D3KooWNTaN849ESU3aY35hYJ5bL8aZALk4gVPiZUa18T4eoNCH", service: "ws",
+		},
+		{name: "empty service", value: testPeerAddr + "/", wantErr: true},
+		{name: "extra segment", value: testPeerAddr + "/ssh/extra", wantErr: true},
+		{name: "no peer ID", value: "/ip4/127.0.0.1/tcp/4001", wantErr: true},
+		{name: "no peer ID with service", value: "/ip4/127.0.0.1/tcp/4001/http", wantErr: true},
+		{name: "invalid peer ID", value: "/p2p/QmInvalid/ssh", wantErr: true},
+		{name: "not address", value: "ssh", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ma, service, err := parseTargetWithService(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTargetWithService(%q) = %v, %q, expected error", tt.value, ma, service)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTargetWithService(%q) failed: %v", tt.value, err)
+			}
+			if !ma.Equal(multiaddr.StringCast(tt.addr)) {
+				t.Errorf("address = %v, expected %v", ma, tt.addr)
+			}
+			if service != tt.service {
+				t.Errorf("service = %q, expected %q", service, tt.service)
+			}
+		})
+	}
+}
+
+func TestForwardMappingUnmarshalFlag(t *testing.T) {
+	var m ForwardMapping
+	if err := m.UnmarshalFlag("/ip4/127.0.0.1/tcp/8080=" + testPeerAddr + "/https"); err != nil {
+		t.Fatal(err)
+	}
+	if m.ListenAddr().String() != "/ip4/127.0.0.1/tcp/8080" {
+		t.Errorf("listen address = %v", m.ListenAddr())
+	}
+	if !m.TargetAddr().Equal(multiaddr.StringCast(testPeerAddr)) || m.ServiceName() != "https" {
+		t.Errorf("target = %v, service = %q", m.TargetAddr(), m.ServiceName())
+	}
+
+	if err := m.UnmarshalFlag("/ip4/127.0.0.1/tcp/8080"); err == nil {
+		t.Error("expected error for mapping without target")
+	}
+}
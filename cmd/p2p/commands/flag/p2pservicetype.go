@@ -30,7 +30,7 @@ type P2PServiceType p2pservice.Type
 func (a *P2PServiceType) UnmarshalFlag(value string) error {
 	dataType, ok := p2pServiceTypes[strings.ToLower(value)]
 	if !ok {
-		return fmt.Errorf("unsupported key type '%v', use one of: %v", value, p2pServiceTypeSetStr)
+		return fmt.Errorf("unsupported p2p service type '%v', use one of: %v", value, p2pServiceTypeSetStr)
 	}
 
 	*a = P2PServiceType(dataType)
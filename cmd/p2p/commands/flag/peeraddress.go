@@ -0,0 +1,25 @@
+package flag
+
+import (
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+type PeerAddress struct {
+	pa peer.AddrInfo
+}
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (a *PeerAddress) UnmarshalFlag(value string) error {
+	pa, err := acl.ParseAddrInfo(value)
+	if err != nil {
+		return err
+	}
+	a.pa = *pa
+	return nil
+}
+
+// AsAddrInfo returns peer.AddrInfo
+func (a *PeerAddress) AsAddrInfo() peer.AddrInfo {
+	return a.pa
+}
@@ -0,0 +1,39 @@
+package flag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/listener"
+	"github.com/multiformats/go-multiaddr"
+)
+
+type Service struct {
+	s listener.Service
+}
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (a *Service) UnmarshalFlag(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid service '%v', expected <name>=<target-address>", value)
+	}
+
+	name := kv[0]
+	if err := listener.ValidateServiceName(name); err != nil {
+		return err
+	}
+
+	targetAddr, err := multiaddr.NewMultiaddr(kv[1])
+	if err != nil {
+		return err
+	}
+
+	a.s = listener.Service{Name: name, TargetAddr: targetAddr}
+	return nil
+}
+
+// AsService returns listener.Service
+func (a *Service) AsService() listener.Service {
+	return a.s
+}
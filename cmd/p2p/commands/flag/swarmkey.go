@@ -0,0 +1,21 @@
+package flag
+
+import (
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/pnet"
+)
+
+type SwarmKey struct {
+	p pnet.Protector
+}
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (a *SwarmKey) UnmarshalFlag(value string) (err error) {
+	a.p, err = p2p.ReadSwarmKey(value)
+	return
+}
+
+// AsProtector returns pnet.Protector
+func (a *SwarmKey) AsProtector() pnet.Protector {
+	return a.p
+}
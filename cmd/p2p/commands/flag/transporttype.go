@@ -0,0 +1,43 @@
+package flag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/types/transport"
+)
+
+var (
+	transportTypes      = make(map[string]transport.Type)
+	transportTypeSetStr string
+)
+
+func init() {
+	keys := make([]string, 0, len(transport.TypeValues()))
+
+	for _, k := range transport.TypeValues() {
+		keyStr := strings.ToLower(k.String())
+		transportTypes[keyStr] = k
+		keys = append(keys, keyStr)
+	}
+
+	transportTypeSetStr = strings.Join(keys, ", ")
+}
+
+type TransportType transport.Type
+
+// UnmarshalFlag implements flags.Unmarshaler interface
+func (a *TransportType) UnmarshalFlag(value string) error {
+	dataType, ok := transportTypes[strings.ToLower(value)]
+	if !ok {
+		return fmt.Errorf("unsupported transport '%v', use one of: %v", value, transportTypeSetStr)
+	}
+
+	*a = TransportType(dataType)
+
+	return nil
+}
+
+func (a *TransportType) AsTransport() transport.Type {
+	return transport.Type(*a)
+}
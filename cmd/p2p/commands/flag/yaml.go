@@ -0,0 +1,42 @@
+package flag
+
+import "github.com/jessevdk/go-flags"
+
+// unmarshalYAML unmarshals YAML scalar value the same way as command line flag value
+func unmarshalYAML(u flags.Unmarshaler, unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return u.UnmarshalFlag(value)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface
+func (a *MultiAddress) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalYAML(a, unmarshal)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface
+func (a *PeerAddress) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalYAML(a, unmarshal)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface
+func (a *P2PServiceType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalYAML(a, unmarshal)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface
+func (a *TransportType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalYAML(a, unmarshal)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface
+func (r *ByteRate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalYAML(r, unmarshal)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface
+func (s *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalYAML(s, unmarshal)
+}
@@ -2,36 +2,92 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/config"
 	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/flag"
 	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/types/p2pservice"
 	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/control"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/forwarder"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/listener"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/socks5"
-	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/multiformats/go-multiaddr"
 )
 
 type ForwardCommand struct {
-	PrivateKey        *flag.PrivateKey    `long:"identity"                       description:"Identity key file."`
-	ListenAddress     flag.MultiAddress   `long:"listen-address" required:"true" description:"Listen address to accept incoming connections."`
-	TargetAddress     flag.MultiAddress   `long:"target-address" required:"true" description:"Target p2p address to forward connections to."`
-	TargetServiceType flag.P2PServiceType `long:"target-service" required:"true" description:"Target service type (socks5, portforwarder)."`
+	NodeOptions         `group:"Node Options"`
+	AccessLogOptions    `group:"Access Log Options"`
+	RateLimitOptions    `group:"Rate Limit Options"`
+	SessionLimitOptions `group:"Session Limit Options"`
+	BufferOptions       `group:"Buffer Options"`
+
+	ListenAddress     flag.MultiAddress     `long:"listen-address"                         description:"Listen address to accept incoming connections."`
+	TargetAddress     flag.MultiAddress     `long:"target-address"                         description:"Target p2p address to forward connections to."`
+	TargetRendezvous  string                `long:"target-rendezvous"                      description:"Rendezvous name the target peer is advertised under, used instead of --target-address."`
+	TargetServiceType flag.P2PServiceType   `long:"target-service" default:"portforwarder" description:"Target service type (socks5, portforwarder)."`
+	ServiceName       string                `long:"service"                                description:"Name of the target portforwarder service, default service is used if not specified."`
+	Mappings          []flag.ForwardMapping `long:"map"                                    description:"Forward connections made to local address to p2p target: <listen-address>=<target-address>[/<service>] (can be repeated)."`
+	UDPIdleTimeout    time.Duration         `long:"udp-idle-timeout"                       description:"Timeout after which UDP session without datagrams is closed (default: 1m)."`
+	IdleTimeout       time.Duration         `long:"idle-timeout"                           description:"Timeout after which TCP or unix socket session without data in any direction is closed (default: no timeout)."`
+	MaxLifetime       time.Duration         `long:"max-lifetime"                           description:"Maximum lifetime of the session (default: unlimited)."`
+	UnixSocketMode    os.FileMode           `long:"unix-socket-mode" base:"8"              description:"Permissions of unix socket file created for unix listen address (default: 0600)."`
+}
+
+// forward describes single forwarding from local listen address to p2p target.
+type forward struct {
+	listenAddr multiaddr.Multiaddr
+	target     targetSpec
+	protocolID protocol.ID
+	opts       []forwarder.Option
 }
 
 // Execute implements flags.Commander interface
 func (c *ForwardCommand) Execute(args []string) error {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	forwards, err := c.forwards(cfg.Forward)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(createCtrlCContext())
 	defer cancel()
 
-	var opts []libp2p.Option
-	if pk := c.PrivateKey; pk != nil {
-		opts = append(opts, libp2p.Identity(pk.AsPrivKey()))
+	rateLimiter := c.limiter(cfg.RateLimit)
+	sessionLimits := c.limits(cfg.SessionLimits)
+	bufferSize, err := c.bufferSize(cfg)
+	if err != nil {
+		return err
+	}
+
+	accessLog, err := c.open(cfg)
+	if err != nil {
+		return err
+	}
+	if accessLog != nil {
+		defer func() {
+			if cErr := accessLog.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+	// options of all forwarders, including ones created via control API
+	fwdOpts := []forwarder.Option{
+		forwarder.WithAccessLog(accessLog),
+		forwarder.WithRateLimiter(rateLimiter),
+		forwarder.WithSessionLimits(sessionLimits),
+		forwarder.WithBufferSize(bufferSize),
 	}
 
-	node, err := p2p.NewNode(ctx, opts...)
+	node, err := c.newNode(ctx, cfg)
 	if err != nil {
 		return err
 	}
@@ -41,31 +97,219 @@ func (c *ForwardCommand) Execute(args []string) error {
 		}
 	}()
 
-	var targetProtocolID protocol.ID
-	switch c.TargetServiceType.AsP2PService() {
-	case p2pservice.PortForwarder:
-		targetProtocolID = listener.ID
-	case p2pservice.Socks5:
-		targetProtocolID = socks5.ID
-	default:
-		return fmt.Errorf("unsupported p2p service type: %v", c.TargetServiceType)
+	ms, err := c.startMetrics(cfg, node)
+	if err != nil {
+		return err
+	}
+	if ms != nil {
+		defer func() {
+			if cErr := ms.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
 	}
 
-	fwd, err := forwarder.New(ctx, node, c.ListenAddress.AsMultiaddr(), c.TargetAddress.AsMultiaddr(), targetProtocolID)
+	ctl, err := c.startControl(ctx, cfg, node, cancel, fwdOpts...)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if cErr := fwd.Close(); cErr != nil && err == nil {
-			err = cErr
-		}
-	}()
+	if ctl != nil {
+		defer func() {
+			if cErr := ctl.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
 
 	fmt.Println("Forwarder started:", node.ID().Pretty())
-	fmt.Println("Forwarder listens on:", c.ListenAddress.AsMultiaddr().String())
-	fmt.Println("Connections will be forwarded to:", c.TargetAddress.AsMultiaddr().String())
+
+	for _, f := range forwards {
+		fwd, err := f.start(ctx, node, fwdOpts...)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cErr := fwd.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+		if ctl != nil {
+			ctl.AddForwarder(fwd)
+		}
+
+		fmt.Printf("Connections made to %v will be forwarded to %v (%v)\n", f.listenAddr, fwd.Target(), fwd.ProtocolID())
+	}
 
 	<-ctx.Done()
 
 	return nil
 }
+
+// start starts forwarder, opts are applied after the forward options.
+func (f *forward) start(ctx context.Context, node *p2p.Node, opts ...forwarder.Option) (*forwarder.Forwarder, error) {
+	target, err := f.target.resolve(node)
+	if err != nil {
+		return nil, err
+	}
+
+	fwdOpts := make([]forwarder.Option, 0, len(f.opts)+len(opts)+1)
+	fwdOpts = append(append(fwdOpts, f.opts...), opts...)
+	if f.protocolID == socks5.ID {
+		// socks5 UDP associate is served with local UDP relay
+		fwdOpts = append(fwdOpts, forwarder.WithConnHandler(socks5.ForwardConn))
+	}
+	return forwarder.New(ctx, node, f.listenAddr, target, f.protocolID, fwdOpts...)
+}
+
+// forwardFactory returns factory of the forwarders requested via control API, opts are applied to every forwarder.
+func forwardFactory(node *p2p.Node, opts ...forwarder.Option) control.ForwardFactory {
+	return func(ctx context.Context, req control.ForwardRequest) (*forwarder.Forwarder, error) {
+		f, err := requestedForward(req)
+		if err != nil {
+			return nil, err
+		}
+		return f.start(ctx, node, opts...)
+	}
+}
+
+// requestedForward returns forward requested via control API.
+func requestedForward(req control.ForwardRequest) (*forward, error) {
+	var listenAddr, targetAddr flag.MultiAddress
+	if err := listenAddr.UnmarshalFlag(req.Listen); err != nil {
+		return nil, fmt.Errorf("invalid listen address: %v", err)
+	}
+	if req.Target != "" {
+		if err := targetAddr.UnmarshalFlag(req.Target); err != nil {
+			return nil, fmt.Errorf("invalid target address: %v", err)
+		}
+	}
+	if (req.Target == "") == (req.Rendezvous == "") {
+		return nil, errors.New("exactly one of target and rendezvous must be specified")
+	}
+
+	serviceType := flag.P2PServiceType(p2pservice.PortForwarder)
+	if req.Type != "" {
+		if err := serviceType.UnmarshalFlag(req.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	protocolID, err := targetProtocolID(serviceType.AsP2PService(), req.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	return &forward{
+		listenAddr: listenAddr.AsMultiaddr(),
+		target:     targetSpec{addr: targetAddr.AsMultiaddr(), rendezvous: req.Rendezvous},
+		protocolID: protocolID,
+	}, nil
+}
+
+// forwards returns forwards specified by command line options, if none specified, then forwards from config are used.
+func (c *ForwardCommand) forwards(cfg config.Forward) ([]forward, error) {
+	var forwards []forward
+
+	listenAddr, targetAddr := c.ListenAddress.AsMultiaddr(), c.TargetAddress.AsMultiaddr()
+	if targetAddr != nil && c.TargetRendezvous != "" {
+		return nil, errors.New("--target-address and --target-rendezvous cannot be specified together")
+	}
+	hasTarget := targetAddr != nil || c.TargetRendezvous != ""
+	switch {
+	case listenAddr != nil && hasTarget:
+		protocolID, err := targetProtocolID(c.TargetServiceType.AsP2PService(), c.ServiceName)
+		if err != nil {
+			return nil, err
+		}
+		target := targetSpec{addr: targetAddr, rendezvous: c.TargetRendezvous}
+		forwards = append(forwards, forward{listenAddr: listenAddr, target: target, protocolID: protocolID, opts: c.forwarderOptions(nil)})
+	case listenAddr != nil || hasTarget:
+		return nil, errors.New("--listen-address and --target-address (or --target-rendezvous) must be specified together")
+	}
+
+	for i := range c.Mappings {
+		m := &c.Mappings[i]
+		protocolID, err := targetProtocolID(c.TargetServiceType.AsP2PService(), m.ServiceName())
+		if err != nil {
+			return nil, err
+		}
+		target := targetSpec{addr: m.TargetAddr()}
+		forwards = append(forwards, forward{listenAddr: m.ListenAddr(), target: target, protocolID: protocolID, opts: c.forwarderOptions(nil)})
+	}
+
+	if len(forwards) == 0 {
+		for i := range cfg.Forwards {
+			m := &cfg.Forwards[i]
+			protocolID, err := targetProtocolID(m.Type.AsP2PService(), m.Service)
+			if err != nil {
+				return nil, err
+			}
+			target := targetSpec{addr: m.Target.AsMultiaddr(), rendezvous: m.Rendezvous}
+			if (target.addr == nil) == (target.rendezvous == "") {
+				return nil, fmt.Errorf("forward from %v: exactly one of target and rendezvous must be specified", m.Listen.AsMultiaddr())
+			}
+			forwards = append(forwards, forward{listenAddr: m.Listen.AsMultiaddr(), target: target, protocolID: protocolID, opts: c.forwarderOptions(m)})
+		}
+	}
+
+	if len(forwards) == 0 {
+		return nil, errors.New("nothing to forward: specify --listen-address and --target-address or at least one --map")
+	}
+
+	return forwards, nil
+}
+
+// forwarderOptions returns forwarder options specified by command line options, if some option is not specified, then
+// value from forward config is used (if any).
+func (c *ForwardCommand) forwarderOptions(cfg *config.ForwardMapping) []forwarder.Option {
+	udpIdleTimeout, unixSocketMode := c.UDPIdleTimeout, c.UnixSocketMode
+	idleTimeout, maxLifetime := c.IdleTimeout, c.MaxLifetime
+	if cfg != nil {
+		if udpIdleTimeout == 0 {
+			udpIdleTimeout = cfg.UDPIdleTimeout
+		}
+		if unixSocketMode == 0 {
+			unixSocketMode = cfg.UnixSocketMode
+		}
+		if idleTimeout == 0 {
+			idleTimeout = cfg.IdleTimeout
+		}
+		if maxLifetime == 0 {
+			maxLifetime = cfg.MaxLifetime
+		}
+	}
+
+	return []forwarder.Option{
+		forwarder.WithUDPIdleTimeout(udpIdleTimeout),
+		forwarder.WithUnixSocketMode(unixSocketMode),
+		forwarder.WithIdleTimeout(idleTimeout),
+		forwarder.WithMaxLifetime(maxLifetime),
+	}
+}
+
+// targetSpec is a forward target specified either by p2p address or by rendezvous name.
+type targetSpec struct {
+	addr       multiaddr.Multiaddr
+	rendezvous string
+}
+
+func (t targetSpec) resolve(node *p2p.Node) (forwarder.Target, error) {
+	if t.rendezvous != "" {
+		return forwarder.RendezvousTarget(node, t.rendezvous), nil
+	}
+	return forwarder.PeerTarget(t.addr)
+}
+
+func targetProtocolID(serviceType p2pservice.Type, serviceName string) (protocol.ID, error) {
+	switch serviceType {
+	case p2pservice.PortForwarder:
+		return listener.ServiceProtocolID(serviceName), nil
+	case p2pservice.Socks5:
+		if serviceName != "" {
+			return "", errors.New("service name can be used only with portforwarder target service")
+		}
+		return socks5.ID, nil
+	default:
+		return "", fmt.Errorf("unsupported p2p service type: %v", serviceType)
+	}
+}
@@ -2,31 +2,88 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/config"
 	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/flag"
-	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/forwarder"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/listener"
-	"github.com/libp2p/go-libp2p"
 )
 
 type ListenCommand struct {
-	PrivateKey    *flag.PrivateKey  `long:"identity"                       description:"Identity key file."`
-	TargetAddress flag.MultiAddress `long:"target-address" required:"true" description:"Target address to forward connections to."`
-	ClientAddress flag.MultiAddress `long:"client-address" required:"true" description:"Client p2p address to accept connections from."`
+	NodeOptions         `group:"Node Options"`
+	ClientPeersOptions  `group:"Client Peers Options"`
+	AccessLogOptions    `group:"Access Log Options"`
+	RateLimitOptions    `group:"Rate Limit Options"`
+	SessionLimitOptions `group:"Session Limit Options"`
+	BufferOptions       `group:"Buffer Options"`
+
+	TargetAddress flag.MultiAddress `long:"target-address" description:"Target address of the default service to forward connections to."`
+	Services      []flag.Service    `long:"service"        description:"Named service to forward connections to: <name>=<target-address> (can be repeated)."`
+	Rendezvous    []string          `long:"rendezvous"     description:"Rendezvous name to advertise node under, so forwarders can find it by name (can be repeated)."`
+	IdleTimeout   time.Duration     `long:"idle-timeout"   description:"Timeout after which session without data in any direction is closed (default: no timeout)."`
+	MaxLifetime   time.Duration     `long:"max-lifetime"   description:"Maximum lifetime of the session (default: unlimited)."`
 }
 
 // Execute implements flags.Commander interface
 func (c *ListenCommand) Execute(args []string) error {
-	ctx, cancel := context.WithCancel(createCtrlCContext())
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	services, err := c.services(cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	peers, err := c.ClientPeersOptions.load(cfg.Listen.ClientPeers)
+	if err != nil {
+		return err
+	}
+	clientPeers := acl.NewPeers(peers...)
+
+	ctx, cancel := context.WithCancel(createReloadableCtrlCContext())
 	defer cancel()
 
-	var opts []libp2p.Option
-	if pk := c.PrivateKey; pk != nil {
-		opts = append(opts, libp2p.Identity(pk.AsPrivKey()))
+	reloadClientPeersOnSIGHUP(ctx, clientPeers, func() ([]acl.Peer, error) {
+		cfg, err := c.loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return c.ClientPeersOptions.load(cfg.Listen.ClientPeers)
+	})
+
+	rateLimiter := c.limiter(cfg.RateLimit)
+	sessionLimits := c.limits(cfg.SessionLimits)
+	bufferSize, err := c.bufferSize(cfg)
+	if err != nil {
+		return err
 	}
 
-	node, err := p2p.NewNode(ctx, opts...)
+	accessLog, err := c.open(cfg)
+	if err != nil {
+		return err
+	}
+	if accessLog != nil {
+		defer func() {
+			if cErr := accessLog.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+	// options of all forwarders, including ones created via control API
+	fwdOpts := []forwarder.Option{
+		forwarder.WithAccessLog(accessLog),
+		forwarder.WithRateLimiter(rateLimiter),
+		forwarder.WithSessionLimits(sessionLimits),
+		forwarder.WithBufferSize(bufferSize),
+	}
+
+	node, err := c.newNode(ctx, cfg)
 	if err != nil {
 		return err
 	}
@@ -36,7 +93,38 @@ func (c *ListenCommand) Execute(args []string) error {
 		}
 	}()
 
-	lst, err := listener.New(ctx, node, c.TargetAddress.AsMultiaddr(), c.ClientAddress.AsMultiaddr())
+	ms, err := c.startMetrics(cfg, node)
+	if err != nil {
+		return err
+	}
+	if ms != nil {
+		defer func() {
+			if cErr := ms.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	ctl, err := c.startControl(ctx, cfg, node, cancel, fwdOpts...)
+	if err != nil {
+		return err
+	}
+	if ctl != nil {
+		defer func() {
+			if cErr := ctl.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	lst, err := listener.New(ctx, node, services, clientPeers,
+		listener.WithAccessLog(accessLog),
+		listener.WithRateLimiter(rateLimiter),
+		listener.WithSessionLimits(sessionLimits),
+		listener.WithIdleTimeout(c.idleTimeout(cfg.Listen)),
+		listener.WithMaxLifetime(c.maxLifetime(cfg.Listen)),
+		listener.WithBufferSize(bufferSize),
+	)
 	if err != nil {
 		return err
 	}
@@ -45,11 +133,63 @@ func (c *ListenCommand) Execute(args []string) error {
 			err = cErr
 		}
 	}()
+	if ctl != nil {
+		ctl.AddListener(lst)
+	}
 
 	fmt.Println("Listener started:", node.ID().Pretty())
-	fmt.Println("Connections will be forwarded to:", c.TargetAddress.AsMultiaddr().String())
+	fmt.Println("Authorized client peers:", clientPeers.Len())
+	for _, s := range services {
+		fmt.Printf("Connections to service %q will be forwarded to: %v\n", s.Name, s.TargetAddr)
+	}
+
+	rendezvous := c.Rendezvous
+	if len(rendezvous) == 0 {
+		rendezvous = cfg.Listen.Rendezvous
+	}
+	advertise(node, rendezvous)
 
 	<-ctx.Done()
 
 	return nil
 }
+
+// idleTimeout returns session idle timeout specified by command line option or config.
+func (c *ListenCommand) idleTimeout(cfg config.Listen) time.Duration {
+	if c.IdleTimeout != 0 {
+		return c.IdleTimeout
+	}
+	return cfg.IdleTimeout
+}
+
+// maxLifetime returns maximum session lifetime specified by command line option or config.
+func (c *ListenCommand) maxLifetime(cfg config.Listen) time.Duration {
+	if c.MaxLifetime != 0 {
+		return c.MaxLifetime
+	}
+	return cfg.MaxLifetime
+}
+
+// services returns services specified by command line options, if none specified, then services from config are used.
+func (c *ListenCommand) services(cfg config.Listen) ([]listener.Service, error) {
+	var services []listener.Service
+	if targetAddr := c.TargetAddress.AsMultiaddr(); targetAddr != nil {
+		services = append(services, listener.Service{TargetAddr: targetAddr})
+	}
+	for i := range c.Services {
+		services = append(services, c.Services[i].AsService())
+	}
+
+	if len(services) == 0 {
+		for i := range cfg.Services {
+			s := &cfg.Services[i]
+			services = append(services, listener.Service{Name: s.Name, TargetAddr: s.Target.AsMultiaddr()})
+		}
+	}
+
+	if len(services) == 0 {
+		return nil, errors.New("no services: specify --target-address or at least one --service")
+	}
+
+	return services, nil
+}
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/config"
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/flag"
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/types/transport"
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/control"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/forwarder"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/metrics"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/quic"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	tcp "github.com/libp2p/go-tcp-transport"
+	ws "github.com/libp2p/go-ws-transport"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// transportOptions maps transport type to libp2p transport option and the addresses to listen on if no listen
+// addresses are specified.
+var transportOptions = map[transport.Type]struct {
+	option      libp2p.Option
+	listenAddrs []string
+}{
+	transport.TCP:  {libp2p.Transport(tcp.NewTCPTransport), []string{"/ip4/0.0.0.0/tcp/0", "/ip6/::/tcp/0"}},
+	transport.WS:   {libp2p.Transport(ws.New), []string{"/ip4/0.0.0.0/tcp/0/ws", "/ip6/::/tcp/0/ws"}},
+	transport.QUIC: {libp2p.Transport(quic.NewTransport), []string{"/ip4/0.0.0.0/udp/0/quic", "/ip6/::/udp/0/quic"}},
+}
+
+// NodeOptions are options of the commands that start p2p node.
+type NodeOptions struct {
+	ConfigFile        string               `long:"config"              description:"YAML config file, command line options override values from the file."`
+	PrivateKey        *flag.PrivateKey     `long:"identity"            description:"Identity key file."`
+	Bootstrap         []flag.PeerAddress   `long:"bootstrap"           description:"Bootstrap peer p2p address, used in addition to public bootstrap peers (can be repeated)."`
+	NoPublicBootstrap flag.Bool            `long:"no-public-bootstrap" optional:"yes" optional-value:"true" description:"Do not use public IPFS bootstrap peers, bootstrap only against --bootstrap peers."`
+	DHTServer         flag.Bool            `long:"dht-server"          optional:"yes" optional-value:"true" description:"Run DHT in server mode, so the node can be used as bootstrap peer by other nodes."`
+	SwarmKey          *flag.SwarmKey       `long:"swarm-key"           description:"Private network pre-shared key file, node connects only to the nodes with the same key."`
+	P2PListen         []flag.MultiAddress  `long:"p2p-listen"          description:"Address to listen for p2p connections on, e.g. /ip4/0.0.0.0/tcp/4001 (can be repeated)."`
+	Transports        []flag.TransportType `long:"transport"           description:"Transport to enable: tcp, ws, quic (can be repeated, tcp and ws are enabled by default)."`
+	NoNATPortMap      flag.Bool            `long:"no-nat-port-map"     optional:"yes" optional-value:"true" description:"Do not try to open p2p port in the firewall using UPnP/NAT-PMP."`
+	NoRelay           flag.Bool            `long:"no-relay"            optional:"yes" optional-value:"true" description:"Disable circuit relay, node neither connects through relays nor accepts relayed connections."`
+	NoAutoRelay       flag.Bool            `long:"no-auto-relay"       optional:"yes" optional-value:"true" description:"Do not look for public relays when node is behind NAT, and do not advertise node as public relay with --relay-hop."`
+	Relays            []flag.PeerAddress   `long:"relay"               description:"Relay peer p2p address to keep connection to (can be repeated)."`
+	RelayOnly         flag.Bool            `long:"relay-only"          optional:"yes" optional-value:"true" description:"Announce only circuit addresses through --relay peers, so node is reachable only via relays."`
+	RelayHop          flag.Bool            `long:"relay-hop"           optional:"yes" optional-value:"true" description:"Act as circuit relay for other peers."`
+	RelayHopLimit     int                  `long:"relay-hop-limit"     description:"Maximum number of relayed streams with --relay-hop (default: libp2p limit)."`
+	ControlSocket     string               `long:"control-socket"      description:"Unix socket to serve control API on, see 'p2p ctl' command."`
+	MetricsAddress    flag.MultiAddress    `long:"metrics-address"     description:"Address to serve Prometheus metrics on /metrics path, e.g. /ip4/127.0.0.1/tcp/9100."`
+}
+
+func (o *NodeOptions) loadConfig() (*config.Config, error) {
+	return config.Load(o.ConfigFile)
+}
+
+func (o *NodeOptions) newNode(ctx context.Context, cfg *config.Config) (*p2p.Node, error) {
+	var opts []libp2p.Option
+	if pk := o.PrivateKey; pk != nil {
+		opts = append(opts, libp2p.Identity(pk.AsPrivKey()))
+	} else if cfg.Identity != "" {
+		k, err := p2p.ReadIdentity(cfg.Identity)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, libp2p.Identity(k))
+	}
+
+	transportOpts, err := o.transportOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, transportOpts...)
+
+	nodeCfg, err := o.nodeConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return p2p.NewNode(ctx, nodeCfg, opts...)
+}
+
+// startControl starts control server if control socket is specified by command line option or config, otherwise nil
+// server is returned.
+func (o *NodeOptions) startControl(ctx context.Context, cfg *config.Config, node *p2p.Node, shutdown func(), fwdOpts ...forwarder.Option) (*control.Server, error) {
+	socketPath := o.ControlSocket
+	if socketPath == "" {
+		socketPath = cfg.ControlSocket
+	}
+	if socketPath == "" {
+		return nil, nil
+	}
+
+	ctl, err := control.New(ctx, node, socketPath, control.WithForwardFactory(forwardFactory(node, fwdOpts...)), control.WithShutdown(shutdown))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Control API socket:", socketPath)
+	return ctl, nil
+}
+
+// startMetrics starts metrics server if metrics address is specified by command line option or config, otherwise nil
+// server is returned.
+func (o *NodeOptions) startMetrics(cfg *config.Config, node *p2p.Node) (*metrics.Server, error) {
+	addr := o.MetricsAddress.AsMultiaddr()
+	if addr == nil {
+		addr = cfg.MetricsAddress.AsMultiaddr()
+	}
+	if addr == nil {
+		return nil, nil
+	}
+
+	ms, err := metrics.New(node, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Metrics address:", addr)
+	return ms, nil
+}
+
+// transportOptions returns libp2p options for the listen addresses and transports specified by command line options
+// or config. If transports are specified without listen addresses, node listens on random ports of each transport.
+// If transports are not specified, default ones are used, QUIC is added to them if some listen address is QUIC one.
+func (o *NodeOptions) transportOptions(cfg *config.Config) ([]libp2p.Option, error) {
+	listenAddrs := o.P2PListen
+	if len(listenAddrs) == 0 {
+		listenAddrs = cfg.P2PListen
+	}
+	transports := o.Transports
+	if len(transports) == 0 {
+		transports = cfg.Transports
+	}
+
+	var opts []libp2p.Option
+	addrs := make([]multiaddr.Multiaddr, 0, len(listenAddrs))
+	for i := range listenAddrs {
+		addrs = append(addrs, listenAddrs[i].AsMultiaddr())
+	}
+
+	if len(transports) == 0 && hasQUICAddress(addrs) {
+		// QUIC is not enabled by default, listening on QUIC address enables it in addition to default transports
+		transports = []flag.TransportType{flag.TransportType(transport.TCP), flag.TransportType(transport.WS), flag.TransportType(transport.QUIC)}
+	}
+
+	seen := make(map[transport.Type]bool, len(transports))
+	for i := range transports {
+		t := transports[i].AsTransport()
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		to, ok := transportOptions[t]
+		if !ok {
+			return nil, fmt.Errorf("unsupported transport: %v", t)
+		}
+		opts = append(opts, to.option)
+
+		if len(listenAddrs) == 0 {
+			for _, s := range to.listenAddrs {
+				addrs = append(addrs, multiaddr.StringCast(s))
+			}
+		}
+	}
+
+	if len(addrs) > 0 {
+		opts = append(opts, libp2p.ListenAddrs(addrs...))
+	}
+
+	return opts, nil
+}
+
+// hasQUICAddress returns true if some of the addresses is QUIC address.
+func hasQUICAddress(addrs []multiaddr.Multiaddr) bool {
+	for _, addr := range addrs {
+		if _, err := addr.ValueForProtocol(multiaddr.P_QUIC); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeConfig returns node config specified by command line options, if some option is not specified, then value from
+// config is used.
+func (o *NodeOptions) nodeConfig(cfg *config.Config) (p2p.NodeConfig, error) {
+	bootstrap := o.Bootstrap
+	if len(bootstrap) == 0 {
+		bootstrap = cfg.Bootstrap
+	}
+
+	bootstrapPeers := make([]peer.AddrInfo, 0, len(bootstrap))
+	for i := range bootstrap {
+		bootstrapPeers = append(bootstrapPeers, bootstrap[i].AsAddrInfo())
+	}
+
+	var privateNetwork pnet.Protector
+	if sk := o.SwarmKey; sk != nil {
+		privateNetwork = sk.AsProtector()
+	} else if cfg.SwarmKey != "" {
+		p, err := p2p.ReadSwarmKey(cfg.SwarmKey)
+		if err != nil {
+			return p2p.NodeConfig{}, err
+		}
+		privateNetwork = p
+	}
+
+	relay := o.Relays
+	if len(relay) == 0 {
+		relay = cfg.Relays
+	}
+
+	relays := make([]peer.AddrInfo, 0, len(relay))
+	for i := range relay {
+		relays = append(relays, relay[i].AsAddrInfo())
+	}
+
+	relayHopLimit := o.RelayHopLimit
+	if relayHopLimit == 0 {
+		relayHopLimit = cfg.RelayHopLimit
+	}
+
+	return p2p.NodeConfig{
+		BootstrapPeers:    bootstrapPeers,
+		NoPublicBootstrap: o.NoPublicBootstrap.Or(cfg.NoPublicBootstrap),
+		DHTServer:         o.DHTServer.Or(cfg.DHTServer),
+		PrivateNetwork:    privateNetwork,
+		NoNATPortMap:      o.NoNATPortMap.Or(cfg.NoNATPortMap),
+		NoRelay:           o.NoRelay.Or(cfg.NoRelay),
+		NoAutoRelay:       o.NoAutoRelay.Or(cfg.NoAutoRelay),
+		Relays:            relays,
+		RelayOnly:         o.RelayOnly.Or(cfg.RelayOnly),
+		RelayHop:          o.RelayHop.Or(cfg.RelayHop),
+		RelayHopLimit:     relayHopLimit,
+	}, nil
+}
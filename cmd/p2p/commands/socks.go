@@ -3,29 +3,98 @@ package commands
 import (
 	"context"
 	"fmt"
+	"net"
+	"time"
 
-	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/flag"
-	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/cmd/p2p/commands/config"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/dns"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/forwarder"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/socks5"
-	"github.com/libp2p/go-libp2p"
 )
 
 type Socks5Command struct {
-	PrivateKey    *flag.PrivateKey  `long:"identity"                       description:"Identity key file."`
-	ClientAddress flag.MultiAddress `long:"client-address" required:"true" description:"Client p2p address to accept connections from."`
+	NodeOptions             `group:"Node Options"`
+	ClientPeersOptions      `group:"Client Peers Options"`
+	DestinationRulesOptions `group:"Destination Rules Options"`
+	DNSOptions              `group:"DNS Options"`
+	AccessLogOptions        `group:"Access Log Options"`
+	RateLimitOptions        `group:"Rate Limit Options"`
+	SessionLimitOptions     `group:"Session Limit Options"`
+	BufferOptions           `group:"Buffer Options"`
+
+	Rendezvous   []string      `long:"rendezvous"    description:"Rendezvous name to advertise node under, so forwarders can find it by name (can be repeated)."`
+	DrainTimeout time.Duration `long:"drain-timeout" description:"How long to wait on exit for active sessions to finish before they are reset (default: reset immediately)."`
+	BindTimeout  time.Duration `long:"bind-timeout"  description:"How long BIND request waits for inbound connection (default: 1m)."`
+	IdleTimeout  time.Duration `long:"idle-timeout"  description:"Timeout after which session without data in any direction is closed (default: no timeout)."`
 }
 
 // Execute implements flags.Commander interface
 func (c *Socks5Command) Execute(args []string) error {
-	ctx, cancel := context.WithCancel(createCtrlCContext())
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	peers, err := c.ClientPeersOptions.load(cfg.Socks5.ClientPeers)
+	if err != nil {
+		return err
+	}
+	clientPeers := acl.NewPeers(peers...)
+
+	rules, err := c.DestinationRulesOptions.load(cfg.Socks5)
+	if err != nil {
+		return err
+	}
+	destRules := acl.NewDestinationRules(rules...)
+
+	resolver, err := c.DNSOptions.resolver(cfg.Socks5.DNS)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(createReloadableCtrlCContext())
 	defer cancel()
 
-	var opts []libp2p.Option
-	if pk := c.PrivateKey; pk != nil {
-		opts = append(opts, libp2p.Identity(pk.AsPrivKey()))
+	reloadClientPeersOnSIGHUP(ctx, clientPeers, func() ([]acl.Peer, error) {
+		cfg, err := c.loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return c.ClientPeersOptions.load(cfg.Socks5.ClientPeers)
+	})
+	reloadDestinationRulesOnSIGHUP(ctx, destRules, func() ([]acl.DestinationRule, error) {
+		cfg, err := c.loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return c.DestinationRulesOptions.load(cfg.Socks5)
+	})
+
+	rateLimiter := c.limiter(cfg.RateLimit)
+	sessionLimits := c.limits(cfg.SessionLimits)
+	bufferSize, err := c.bufferSize(cfg)
+	if err != nil {
+		return err
+	}
+
+	accessLog, err := c.open(cfg)
+	if err != nil {
+		return err
 	}
+	if accessLog != nil {
+		defer func() {
+			if cErr := accessLog.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	// node and socks5 service are not stopped by Ctrl-C context, but closed on exit, so active sessions can be drained
+	serviceCtx, serviceCancel := context.WithCancel(context.Background())
+	defer serviceCancel()
 
-	node, err := p2p.NewNode(ctx, opts...)
+	node, err := c.newNode(serviceCtx, cfg)
 	if err != nil {
 		return err
 	}
@@ -35,7 +104,48 @@ func (c *Socks5Command) Execute(args []string) error {
 		}
 	}()
 
-	lst, err := socks5.New(ctx, node.Host, c.ClientAddress.AsMultiaddr())
+	ms, err := c.startMetrics(cfg, node)
+	if err != nil {
+		return err
+	}
+	if ms != nil {
+		defer func() {
+			if cErr := ms.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	// options of forwarders created via control API
+	fwdOpts := []forwarder.Option{
+		forwarder.WithAccessLog(accessLog),
+		forwarder.WithRateLimiter(rateLimiter),
+		forwarder.WithSessionLimits(sessionLimits),
+		forwarder.WithBufferSize(bufferSize),
+	}
+	ctl, err := c.startControl(ctx, cfg, node, cancel, fwdOpts...)
+	if err != nil {
+		return err
+	}
+	if ctl != nil {
+		defer func() {
+			if cErr := ctl.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}()
+	}
+
+	lst, err := socks5.New(serviceCtx, node.Host, clientPeers,
+		socks5.WithAccessLog(accessLog),
+		socks5.WithRateLimiter(rateLimiter),
+		socks5.WithSessionLimits(sessionLimits),
+		socks5.WithIdleTimeout(c.idleTimeout(cfg.Socks5)),
+		socks5.WithBufferSize(bufferSize),
+		socks5.WithDrainTimeout(c.drainTimeout(cfg.Socks5)),
+		socks5.WithBindTimeout(c.bindTimeout(cfg.Socks5)),
+		socks5.WithDestinationRules(destRules),
+		socks5.WithResolver(resolver),
+	)
 	if err != nil {
 		return err
 	}
@@ -44,10 +154,129 @@ func (c *Socks5Command) Execute(args []string) error {
 			err = cErr
 		}
 	}()
+	if ctl != nil {
+		ctl.AddSocks5(lst)
+	}
 
 	fmt.Println("Socks5 started:", node.ID().Pretty())
+	fmt.Println("Authorized client peers:", clientPeers.Len())
+	fmt.Println("Destination rules:", destRules.Len())
+
+	rendezvous := c.Rendezvous
+	if len(rendezvous) == 0 {
+		rendezvous = cfg.Socks5.Rendezvous
+	}
+	advertise(node, rendezvous)
 
 	<-ctx.Done()
 
 	return nil
 }
+
+// drainTimeout returns drain timeout specified by command line option or config.
+func (c *Socks5Command) drainTimeout(cfg config.Socks5) time.Duration {
+	if c.DrainTimeout != 0 {
+		return c.DrainTimeout
+	}
+	return cfg.DrainTimeout
+}
+
+// bindTimeout returns bind timeout specified by command line option or config.
+func (c *Socks5Command) bindTimeout(cfg config.Socks5) time.Duration {
+	if c.BindTimeout != 0 {
+		return c.BindTimeout
+	}
+	return cfg.BindTimeout
+}
+
+// idleTimeout returns idle timeout specified by command line option or config.
+func (c *Socks5Command) idleTimeout(cfg config.Socks5) time.Duration {
+	if c.IdleTimeout != 0 {
+		return c.IdleTimeout
+	}
+	return cfg.IdleTimeout
+}
+
+// DestinationRulesOptions are options of the socks5 command that restrict destinations peers are allowed to access.
+type DestinationRulesOptions struct {
+	DestinationRules     []string `long:"destination-rule"  description:"Destination rule: allow|deny <host>[,<host>...] [ports=<port>[,<port>...]] [peers=<peer-id>[,<peer-id>...]], where host is IP, CIDR, domain suffix or '*', port is port, range <from>-<to> or '*'. Rules are checked in order, the first matching rule decides, requests not matching any rule are allowed (can be repeated)."`
+	DestinationRulesFile string   `long:"destination-rules" description:"File with destination rules, one per line, checked after --destination-rule rules. Reloaded on SIGHUP."`
+}
+
+// load returns destination rules specified by command line options, if none specified, then rules from config are
+// used.
+func (o *DestinationRulesOptions) load(cfg config.Socks5) ([]acl.DestinationRule, error) {
+	defs, rulesFile := o.DestinationRules, o.DestinationRulesFile
+	if len(defs) == 0 && rulesFile == "" {
+		defs, rulesFile = cfg.DestinationRules, cfg.DestinationRulesFile
+	}
+
+	rules, err := acl.ParseDestinationRules(defs...)
+	if err != nil {
+		return nil, err
+	}
+
+	if rulesFile != "" {
+		fileRules, err := acl.ReadDestinationRulesFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	return rules, nil
+}
+
+// DNSOptions are options of the socks5 command that configure resolution of destination names.
+type DNSOptions struct {
+	DNSServers []string      `long:"dns-server"  description:"DNS server (IP[:port]) used to resolve destination names not matching any --dns-rule, system resolver is used if not specified (can be repeated)."`
+	DNSRules   []string      `long:"dns-rule"    description:"Split-horizon rule: <domain>=<server>[,<server>...], names matching the domain suffix are resolved by the servers, the most specific domain wins (can be repeated)."`
+	DNSHosts   []string      `long:"dns-host"    description:"Static host: <name>=<ip>, the name is resolved to the IP address without DNS queries (can be repeated)."`
+	DNSTimeout time.Duration `long:"dns-timeout" description:"Timeout of single name resolution (default: 5s)."`
+}
+
+// resolver returns resolver configured by command line options, if some option is not specified, then value from
+// config is used. Static hosts from the options override the ones from config.
+func (o *DNSOptions) resolver(cfg config.DNS) (*dns.Resolver, error) {
+	dnsCfg := dns.Config{
+		Servers: o.DNSServers,
+		Hosts:   make(map[string]net.IP),
+		Timeout: o.DNSTimeout,
+	}
+	if len(dnsCfg.Servers) == 0 {
+		dnsCfg.Servers = cfg.Servers
+	}
+	if dnsCfg.Timeout == 0 {
+		dnsCfg.Timeout = cfg.Timeout
+	}
+
+	if len(o.DNSRules) == 0 {
+		for _, r := range cfg.Rules {
+			dnsCfg.Rules = append(dnsCfg.Rules, dns.Rule{Domain: r.Domain, Servers: r.Servers})
+		}
+	}
+	for _, def := range o.DNSRules {
+		r, err := dns.ParseRule(def)
+		if err != nil {
+			return nil, err
+		}
+		dnsCfg.Rules = append(dnsCfg.Rules, r)
+	}
+
+	for name, addr := range cfg.Hosts {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address '%v' of host '%v'", addr, name)
+		}
+		dnsCfg.Hosts[name] = ip
+	}
+	for _, def := range o.DNSHosts {
+		name, ip, err := dns.ParseHost(def)
+		if err != nil {
+			return nil, err
+		}
+		dnsCfg.Hosts[name] = ip
+	}
+
+	return dns.New(dnsCfg)
+}
@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+)
+
+type SwarmKeyGenCommand struct {
+	File string `short:"f" long:"swarm-key" required:"true" description:"Output private network pre-shared key file"`
+}
+
+// Execute implements flags.Commander interface
+func (c *SwarmKeyGenCommand) Execute(args []string) error {
+	protector, err := p2p.GenerateSwarmKey(c.File)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Swarm key fingerprint: %s\n", hex.EncodeToString(protector.Fingerprint()))
+
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:generate enumer -type=Type
+
+package transport
+
+type Type int
+
+const (
+	// TCP is an enum for the TCP transport
+	TCP Type = iota
+	// WS is an enum for the websocket transport
+	WS
+	// QUIC is an enum for the QUIC transport
+	QUIC
+)
@@ -5,8 +5,6 @@ go 1.13
 require (
 	github.com/alvaroloes/enumer v1.1.2 // indirect
 	github.com/armon/go-socks5 v0.0.0-20160902184237-e75332964ef5
-	github.com/golang/protobuf v1.3.2 // indirect
-	github.com/google/go-cmp v0.3.0 // indirect
 	github.com/ipfs/go-cid v0.0.3
 	github.com/ipfs/go-log v0.0.1
 	github.com/jbenet/go-temp-err-catcher v0.0.0-20150120210811-aac704a3f4f2
@@ -14,13 +12,19 @@ require (
 	github.com/libp2p/go-libp2p v0.3.1
 	github.com/libp2p/go-libp2p-circuit v0.1.1
 	github.com/libp2p/go-libp2p-core v0.2.2
+	github.com/libp2p/go-libp2p-discovery v0.1.0
 	github.com/libp2p/go-libp2p-kad-dht v0.2.0
+	github.com/libp2p/go-libp2p-pnet v0.1.0
 	github.com/libp2p/go-libp2p-swarm v0.2.1
+	github.com/libp2p/go-libp2p-tls v0.1.3
+	github.com/libp2p/go-libp2p-transport-upgrader v0.1.1
+	github.com/libp2p/go-tcp-transport v0.1.0
+	github.com/libp2p/go-ws-transport v0.1.0
 	github.com/multiformats/go-multiaddr v0.0.4
 	github.com/multiformats/go-multiaddr-net v0.0.1
 	github.com/multiformats/go-multihash v0.0.7
-	github.com/stretchr/testify v1.4.0 // indirect
+	github.com/prometheus/client_golang v1.1.0
+	github.com/quic-go/quic-go v0.40.1
 	github.com/whyrusleeping/go-logging v0.0.0-20170515211332-0457bb6b88fc
-	golang.org/x/sys v0.0.0-20190801041406-cbf593c0f2f3 // indirect
-	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,98 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+var logger = logging.Logger("accesslog")
+
+// Stdout is the path that makes access log written to standard output.
+const Stdout = "-"
+
+// Record is an access log record of the single forwarding session.
+type Record struct {
+	Service     string    `json:"service"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Peer        string    `json:"peer"`                 // remote peer ID
+	PeerAddr    string    `json:"peer_addr"`            // remote peer multiaddr of the connection
+	Relayed     bool      `json:"relayed"`              // connection to the remote peer goes through circuit relay
+	LocalAddr   string    `json:"local_addr,omitempty"` // local client address
+	Target      string    `json:"target"`               // target p2p address, rendezvous or target address
+	Protocol    string    `json:"protocol"`             // p2p protocol ID
+	BytesIn     int64     `json:"bytes_in"`             // bytes received from p2p stream
+	BytesOut    int64     `json:"bytes_out"`            // bytes sent to p2p stream
+	CloseReason string    `json:"close_reason"`
+}
+
+// SessionRecord returns record of the session started at the given time over connection to the remote peer and
+// finished with the copy result.
+func SessionRecord(service string, start time.Time, conn network.Conn, res p2p.CopyResult) *Record {
+	peerAddr := conn.RemoteMultiaddr()
+	return &Record{
+		Service:     service,
+		Start:       start,
+		End:         time.Now(),
+		Peer:        conn.RemotePeer().Pretty(),
+		PeerAddr:    peerAddr.String(),
+		Relayed:     p2p.IsRelayAddr(peerAddr),
+		BytesIn:     res.In,
+		BytesOut:    res.Out,
+		CloseReason: string(res.CloseReason),
+	}
+}
+
+// Logger writes access log records as JSON lines.
+type Logger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// Open opens access log file for appending, Stdout path makes log written to standard output.
+func Open(path string) (*Logger, error) {
+	if path == Stdout {
+		return New(os.Stdout, nil), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return New(f, f), nil
+}
+
+// New returns logger that writes records to w, closer (if any) is closed on Close.
+func New(w io.Writer, c io.Closer) *Logger {
+	return &Logger{enc: json.NewEncoder(w), c: c}
+}
+
+// Log writes the record, it does nothing if logger is nil.
+func (l *Logger) Log(r *Record) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.enc.Encode(r); err != nil {
+		logger.Warningf("failed to write access log record: %v", err)
+	}
+}
+
+// Close closes underlying access log file.
+func (l *Logger) Close() error {
+	if l.c == nil {
+		return nil
+	}
+	return l.c.Close()
+}
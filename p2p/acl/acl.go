@@ -0,0 +1,243 @@
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/strutil"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// AnyTarget allows peer to access any target.
+const AnyTarget = "*"
+
+// Peer is a peer authorized to use p2p service.
+type Peer struct {
+	peer.AddrInfo
+	Label   string   // optional human readable peer name
+	Targets []string // targets peer is allowed to access, empty means any target
+}
+
+// String returns peer label and ID if label is set, otherwise only peer ID.
+func (p *Peer) String() string {
+	if p.Label == "" {
+		return p.ID.Pretty()
+	}
+	return fmt.Sprintf("%s (%s)", p.Label, p.ID.Pretty())
+}
+
+// CanAccess returns true if peer is allowed to access at least one of the given targets.
+func (p *Peer) CanAccess(targets ...string) bool {
+	if len(p.Targets) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.Targets {
+		if allowed == AnyTarget {
+			return true
+		}
+		for _, target := range targets {
+			if allowed == target {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Peers is a thread-safe set of peers authorized to use p2p service.
+type Peers struct {
+	mu    sync.RWMutex
+	peers map[peer.ID]Peer
+}
+
+// NewPeers creates set of authorized peers.
+func NewPeers(peers ...Peer) *Peers {
+	p := &Peers{}
+	p.Replace(peers...)
+	return p
+}
+
+// Replace atomically replaces all authorized peers with the given ones.
+func (p *Peers) Replace(peers ...Peer) {
+	m := make(map[peer.ID]Peer, len(peers))
+	for _, ap := range peers {
+		if existing, ok := m[ap.ID]; ok {
+			ap = merge(existing, ap)
+		}
+		m[ap.ID] = ap
+	}
+
+	p.mu.Lock()
+	p.peers = m
+	p.mu.Unlock()
+}
+
+// Get returns authorized peer with the given ID.
+func (p *Peers) Get(id peer.ID) (Peer, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ap, ok := p.peers[id]
+	return ap, ok
+}
+
+// IsAuthorized returns true if peer with the given ID is in the set.
+func (p *Peers) IsAuthorized(id peer.ID) bool {
+	_, ok := p.Get(id)
+	return ok
+}
+
+// AddrInfos returns addresses of the authorized peers specified with addresses. Peers specified by bare ID are skipped,
+// they connect to the node themselves and must not be looked up in DHT on every connection check.
+func (p *Peers) AddrInfos() []peer.AddrInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	res := make([]peer.AddrInfo, 0, len(p.peers))
+	for _, ap := range p.peers {
+		if len(ap.Addrs) == 0 {
+			continue
+		}
+		res = append(res, ap.AddrInfo)
+	}
+	return res
+}
+
+// Len returns the number of authorized peers.
+func (p *Peers) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.peers)
+}
+
+func merge(a, b Peer) Peer {
+	res := a
+	res.Addrs = append(append([]multiaddr.Multiaddr(nil), a.Addrs...), b.Addrs...)
+	if res.Label == "" {
+		res.Label = b.Label
+	}
+	if len(a.Targets) == 0 || len(b.Targets) == 0 {
+		// one of the entries allows any target
+		res.Targets = nil
+	} else {
+		res.Targets = append(append([]string(nil), a.Targets...), b.Targets...)
+	}
+	return res
+}
+
+// ParseAddrInfo parses peer address, it can be either p2p multiaddress (e.g. /ip4/1.2.3.4/tcp/4001/p2p/QmPeer or
+// /p2p/QmPeer) or bare peer ID.
+func ParseAddrInfo(s string) (*peer.AddrInfo, error) {
+	if !strings.HasPrefix(s, "/") {
+		id, err := peer.IDB58Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		return &peer.AddrInfo{ID: id}, nil
+	}
+
+	ma, err := multiaddr.NewMultiaddr(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return peer.AddrInfoFromP2pAddr(ma)
+}
+
+// ParsePeer parses authorized peer definition in the following format:
+//
+//	<peer-address> [label=<label>] [targets=<target>[,<target>...]]
+//
+// where <peer-address> is parsed by ParseAddrInfo.
+func ParsePeer(s string) (*Peer, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty peer definition")
+	}
+
+	pa, err := ParseAddrInfo(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ap := &Peer{AddrInfo: *pa}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid peer option '%v', expected <key>=<value>", field)
+		}
+
+		switch key, value := kv[0], kv[1]; key {
+		case "label":
+			ap.Label = value
+		case "targets":
+			targets, err := ParseTargets(value)
+			if err != nil {
+				return nil, err
+			}
+			ap.Targets = append(ap.Targets, targets...)
+		default:
+			return nil, fmt.Errorf("unknown peer option '%v'", key)
+		}
+	}
+
+	return ap, nil
+}
+
+// ParseTargets parses comma separated list of targets. Empty list is rejected, because peer without targets is
+// allowed to access any target, so it must be specified by omitting targets or explicitly with AnyTarget.
+func ParseTargets(s string) ([]string, error) {
+	targets := strutil.SplitList(s)
+	if err := CheckTargets(targets); err != nil {
+		return nil, fmt.Errorf("invalid targets '%v': %v", s, err)
+	}
+	return targets, nil
+}
+
+// CheckTargets returns error if the list of targets is empty or contains blank target.
+func CheckTargets(targets []string) error {
+	if len(targets) == 0 {
+		return errors.New("empty list of targets, omit targets or use '*' to allow any target")
+	}
+	for _, t := range targets {
+		if strings.TrimSpace(t) == "" {
+			return errors.New("blank target")
+		}
+	}
+	return nil
+}
+
+// ReadFile reads authorized peers from the file. Every non-empty line of the file contains single peer definition
+// (see ParsePeer), lines starting with '#' are ignored.
+func ReadFile(path string) ([]Peer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var res []Peer
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ap, err := ParsePeer(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", path, lineNo, err)
+		}
+		res = append(res, *ap)
+	}
+
+	return res, scanner.Err()
+}
@@ -0,0 +1,97 @@
+package acl
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testPeerID = "12D3KooWNTaN849ESU3aY35hYJ5bL8aZALk4gVPiZUa18T4eoNCH"
+
+func TestParsePeer(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     string
+		label   string
+		targets []string
+		wantErr bool
+	}{
+		{name: "bare peer ID", def: testPeerID},
+		{name: "p2p address", def: "/ip4/1.2.3.4/tcp/4001/p2p/" + testPeerID},
+		{name: "label", def: testPeerID + " label=alice", label: "alice"},
+		{name: "targets", def: testPeerID + " targets=http,ssh", targets: []string{"http", "ssh"}},
+		{name: "repeated targets", def: testPeerID + " targets=http targets=ssh", targets: []string{"http", "ssh"}},
+		{name: "targets with blanks", def: testPeerID + " targets=http,,ssh,", targets: []string{"http", "ssh"}},
+		{name: "any target", def: testPeerID + " targets=*", targets: []string{AnyTarget}},
+		{name: "label and targets", def: testPeerID + " label=bob targets=http", label: "bob", targets: []string{"http"}},
+		{name: "empty targets", def: testPeerID + " targets=", wantErr: true},
+		{name: "blank targets", def: testPeerID + " targets=,,", wantErr: true},
+		{name: "empty definition", def: "  ", wantErr: true},
+		{name: "invalid peer ID", def: "QmInvalid", wantErr: true},
+		{name: "option without value", def: testPeerID + " label", wantErr: true},
+		{name: "unknown option", def: testPeerID + " color=red", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePeer(tt.def)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePeer(%q) = %+v, expected error", tt.def, p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePeer(%q) failed: %v", tt.def, err)
+			}
+			if p.ID.Pretty() != testPeerID {
+				t.Errorf("ID = %v, expected %v", p.ID.Pretty(), testPeerID)
+			}
+			if p.Label != tt.label {
+				t.Errorf("Label = %q, expected %q", p.Label, tt.label)
+			}
+			if !reflect.DeepEqual(p.Targets, tt.targets) {
+				t.Errorf("Targets = %q, expected %q", p.Targets, tt.targets)
+			}
+		})
+	}
+}
+
+func TestPeerCanAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		access  []string
+		want    bool
+	}{
+		{name: "no targets allow any", access: []string{"ssh"}, want: true},
+		{name: "any target", targets: []string{AnyTarget}, access: []string{"ssh"}, want: true},
+		{name: "allowed target", targets: []string{"http", "ssh"}, access: []string{"ssh"}, want: true},
+		{name: "one of targets allowed", targets: []string{"http"}, access: []string{"ssh", "http"}, want: true},
+		{name: "denied target", targets: []string{"http"}, access: []string{"ssh"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Peer{Targets: tt.targets}
+			if got := p.CanAccess(tt.access...); got != tt.want {
+				t.Errorf("CanAccess(%q) = %v, expected %v", tt.access, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeersAddrInfos(t *testing.T) {
+	bare, err := ParsePeer(otherPeerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withAddr, err := ParsePeer("/ip4/1.2.3.4/tcp/4001/p2p/" + testPeerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos := NewPeers(*bare, *withAddr).AddrInfos()
+	if len(infos) != 1 || infos[0].ID != withAddr.ID || len(infos[0].Addrs) != 1 {
+		t.Errorf("AddrInfos() = %v, expected only %v", infos, withAddr.AddrInfo)
+	}
+}
@@ -0,0 +1,341 @@
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/strutil"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Destination is a host and port peer requests access to. Destination specified by domain name can also have IP
+// address it is resolved to.
+type Destination struct {
+	FQDN string
+	IP   net.IP
+	Port int
+}
+
+// String returns destination host and port.
+func (d Destination) String() string {
+	host := d.FQDN
+	if host == "" {
+		host = d.IP.String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(d.Port))
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	From, To int
+}
+
+// DestinationRule allows or denies access to the destinations matching it.
+type DestinationRule struct {
+	Allow    bool
+	Networks []*net.IPNet // destination IP networks
+	Domains  []string     // destination domain suffixes, both empty networks and domains mean any host
+	Ports    []PortRange  // destination ports, empty means any port
+	Peers    []peer.ID    // peers the rule is applied to, empty means any peer
+
+	def string // rule definition
+}
+
+// String returns rule definition.
+func (r *DestinationRule) String() string {
+	return r.def
+}
+
+// Matches returns true if the rule is applied to the peer accessing the destination.
+func (r *DestinationRule) Matches(p peer.ID, dest Destination) bool {
+	return r.matchesPeer(p) && r.matchesHost(dest) && r.matchesPort(dest.Port)
+}
+
+func (r *DestinationRule) matchesPeer(p peer.ID) bool {
+	if len(r.Peers) == 0 {
+		return true
+	}
+	for _, id := range r.Peers {
+		if id == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DestinationRule) matchesHost(dest Destination) bool {
+	if len(r.Networks) == 0 && len(r.Domains) == 0 {
+		return true
+	}
+	if dest.IP != nil {
+		for _, n := range r.Networks {
+			if n.Contains(dest.IP) {
+				return true
+			}
+		}
+	}
+	if fqdn := strings.TrimSuffix(strings.ToLower(dest.FQDN), "."); fqdn != "" {
+		for _, d := range r.Domains {
+			if fqdn == d || strings.HasSuffix(fqdn, "."+d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *DestinationRule) matchesPort(port int) bool {
+	if len(r.Ports) == 0 {
+		return true
+	}
+	for _, pr := range r.Ports {
+		if port >= pr.From && port <= pr.To {
+			return true
+		}
+	}
+	return false
+}
+
+// DestinationRules is a thread-safe ordered list of destination rules. The first rule matching the request decides
+// whether access is allowed, requests not matching any rule are allowed.
+type DestinationRules struct {
+	mu    sync.RWMutex
+	rules []DestinationRule
+}
+
+// NewDestinationRules creates list of destination rules.
+func NewDestinationRules(rules ...DestinationRule) *DestinationRules {
+	r := &DestinationRules{}
+	r.Replace(rules...)
+	return r
+}
+
+// Replace atomically replaces all rules with the given ones.
+func (r *DestinationRules) Replace(rules ...DestinationRule) {
+	rules = append([]DestinationRule(nil), rules...)
+
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+}
+
+// Allowed returns true if the peer is allowed to access the destination and the rule that decided it (nil if no rule
+// matches). Nil rules allow any destination.
+func (r *DestinationRules) Allowed(p peer.ID, dest Destination) (bool, *DestinationRule) {
+	if r == nil {
+		return true, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range r.rules {
+		if rule := &r.rules[i]; rule.Matches(p, dest) {
+			return rule.Allow, rule
+		}
+	}
+	return true, nil
+}
+
+// NameDenied returns true if the peer is denied access to the domain name regardless of the port and the address the
+// name resolves to, and the rule that decided it. It lets requests be denied before the name is resolved, so denied
+// names don't cause DNS queries. Nil rules don't deny any name.
+func (r *DestinationRules) NameDenied(p peer.ID, fqdn string) (bool, *DestinationRule) {
+	if r == nil {
+		return false, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.matchesPeer(p) {
+			continue
+		}
+		if !rule.matchesHost(Destination{FQDN: fqdn}) {
+			if len(rule.Networks) == 0 {
+				continue
+			}
+			return false, nil // rule can match the address name resolves to
+		}
+		if len(rule.Ports) != 0 {
+			return false, nil // rule matches only some ports
+		}
+		return !rule.Allow, rule
+	}
+	return false, nil
+}
+
+// Len returns the number of rules.
+func (r *DestinationRules) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.rules)
+}
+
+// ParseDestinationRule parses destination rule definition in the following format:
+//
+//	allow|deny <host>[,<host>...] [ports=<port>[,<port>...]] [peers=<peer-id>[,<peer-id>...]]
+//
+// where <host> is either IP address, CIDR network, domain suffix (matches the domain and all its subdomains) or '*'
+// for any host, and <port> is either single port, inclusive port range <from>-<to> or '*' for any port.
+func ParseDestinationRule(s string) (*DestinationRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid destination rule '%v', expected: allow|deny <hosts> [ports=<ports>] [peers=<peers>]", s)
+	}
+
+	rule := &DestinationRule{def: strings.Join(fields, " ")}
+	switch fields[0] {
+	case "allow":
+		rule.Allow = true
+	case "deny":
+	default:
+		return nil, fmt.Errorf("invalid destination rule action '%v', expected allow or deny", fields[0])
+	}
+
+	hosts := strutil.SplitList(fields[1])
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("invalid destination rule '%v': empty list of hosts, use '*' to match any host", s)
+	}
+	for _, host := range hosts {
+		if err := rule.addHost(host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range fields[2:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid destination rule option '%v', expected <key>=<value>", field)
+		}
+
+		key, values := kv[0], strutil.SplitList(kv[1])
+		if len(values) == 0 {
+			return nil, fmt.Errorf("invalid destination rule option '%v': empty list of values", field)
+		}
+
+		switch key {
+		case "ports":
+			for _, port := range values {
+				if err := rule.addPorts(port); err != nil {
+					return nil, err
+				}
+			}
+		case "peers":
+			for _, p := range values {
+				id, err := peer.IDB58Decode(p)
+				if err != nil {
+					return nil, fmt.Errorf("invalid peer ID '%v': %v", p, err)
+				}
+				rule.Peers = append(rule.Peers, id)
+			}
+		default:
+			return nil, fmt.Errorf("unknown destination rule option '%v'", key)
+		}
+	}
+
+	return rule, nil
+}
+
+func (r *DestinationRule) addHost(host string) error {
+	switch {
+	case host == AnyTarget:
+		// any host is matched when there are no networks and domains
+	case strings.Contains(host, "/"):
+		_, n, err := net.ParseCIDR(host)
+		if err != nil {
+			return err
+		}
+		r.Networks = append(r.Networks, n)
+	case net.ParseIP(host) != nil:
+		ip := net.ParseIP(host)
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		r.Networks = append(r.Networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	default:
+		r.Domains = append(r.Domains, strings.TrimPrefix(strings.ToLower(host), "."))
+	}
+	return nil
+}
+
+func (r *DestinationRule) addPorts(ports string) error {
+	if ports == AnyTarget {
+		return nil
+	}
+
+	bounds := strings.SplitN(ports, "-", 2)
+	from, err := parsePort(bounds[0])
+	if err != nil {
+		return err
+	}
+	to := from
+	if len(bounds) == 2 {
+		if to, err = parsePort(bounds[1]); err != nil {
+			return err
+		}
+	}
+	if from > to {
+		return fmt.Errorf("invalid port range '%v'", ports)
+	}
+
+	r.Ports = append(r.Ports, PortRange{From: from, To: to})
+	return nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port '%v'", s)
+	}
+	return port, nil
+}
+
+// ParseDestinationRules parses destination rule definitions (see ParseDestinationRule).
+func ParseDestinationRules(defs ...string) ([]DestinationRule, error) {
+	res := make([]DestinationRule, 0, len(defs))
+	for _, def := range defs {
+		rule, err := ParseDestinationRule(def)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *rule)
+	}
+	return res, nil
+}
+
+// ReadDestinationRulesFile reads destination rules from the file. Every non-empty line of the file contains single
+// rule definition (see ParseDestinationRule), lines starting with '#' are ignored.
+func ReadDestinationRulesFile(path string) ([]DestinationRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var res []DestinationRule
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := ParseDestinationRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", path, lineNo, err)
+		}
+		res = append(res, *rule)
+	}
+
+	return res, scanner.Err()
+}
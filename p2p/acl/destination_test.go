@@ -0,0 +1,205 @@
+package acl
+
+import (
+	"net"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const otherPeerID = "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC"
+
+func mustDecodePeer(t *testing.T, s string) peer.ID {
+	t.Helper()
+	id, err := peer.IDB58Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustParseRule(t *testing.T, def string) DestinationRule {
+	t.Helper()
+	rule, err := ParseDestinationRule(def)
+	if err != nil {
+		t.Fatalf("ParseDestinationRule(%q) failed: %v", def, err)
+	}
+	return *rule
+}
+
+func TestParseDestinationRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     string
+		wantErr bool
+	}{
+		{name: "any host", def: "allow *"},
+		{name: "hosts", def: "deny 10.0.0.0/8,169.254.169.254,::1,.example.com"},
+		{name: "ports", def: "allow * ports=80,443,8000-8100"},
+		{name: "any port", def: "allow * ports=*"},
+		{name: "peers", def: "allow * peers=" + testPeerID + "," + otherPeerID},
+		{name: "no hosts", def: "allow", wantErr: true},
+		{name: "empty hosts", def: "allow ,", wantErr: true},
+		{name: "empty hosts with options", def: "deny ,, ports=22", wantErr: true},
+		{name: "empty ports", def: "allow * ports=,", wantErr: true},
+		{name: "empty peers", def: "allow * peers=", wantErr: true},
+		{name: "unknown action", def: "permit *", wantErr: true},
+		{name: "invalid network", def: "deny 10.0.0.0/33", wantErr: true},
+		{name: "invalid port", def: "allow * ports=http", wantErr: true},
+		{name: "port out of range", def: "allow * ports=65536", wantErr: true},
+		{name: "reversed port range", def: "allow * ports=443-80", wantErr: true},
+		{name: "invalid peer", def: "allow * peers=QmInvalid", wantErr: true},
+		{name: "option without value", def: "allow * ports", wantErr: true},
+		{name: "unknown option", def: "allow * proto=tcp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseDestinationRule(tt.def)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDestinationRule(%q) = %+v, expected error", tt.def, rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDestinationRule(%q) failed: %v", tt.def, err)
+			}
+			if rule.String() != tt.def {
+				t.Errorf("String() = %q, expected %q", rule.String(), tt.def)
+			}
+		})
+	}
+}
+
+func TestDestinationRuleMatches(t *testing.T) {
+	alice, bob := mustDecodePeer(t, testPeerID), mustDecodePeer(t, otherPeerID)
+
+	tests := []struct {
+		name string
+		rule string
+		peer peer.ID
+		dest Destination
+		want bool
+	}{
+		{name: "wildcard", rule: "allow *", peer: alice, dest: Destination{FQDN: "example.com", Port: 80}, want: true},
+		{name: "ip", rule: "deny 169.254.169.254", peer: alice, dest: Destination{IP: net.ParseIP("169.254.169.254"), Port: 80}, want: true},
+		{name: "other ip", rule: "deny 169.254.169.254", peer: alice, dest: Destination{IP: net.ParseIP("169.254.169.253"), Port: 80}},
+		{name: "cidr", rule: "deny 10.0.0.0/8", peer: alice, dest: Destination{IP: net.ParseIP("10.1.2.3"), Port: 22}, want: true},
+		{name: "outside cidr", rule: "deny 10.0.0.0/8", peer: alice, dest: Destination{IP: net.ParseIP("11.1.2.3"), Port: 22}},
+		{name: "resolved name in cidr", rule: "deny 10.0.0.0/8", peer: alice, dest: Destination{FQDN: "db.local", IP: net.ParseIP("10.0.0.5"), Port: 5432}, want: true},
+		{name: "ipv6", rule: "deny ::1", peer: alice, dest: Destination{IP: net.ParseIP("::1"), Port: 22}, want: true},
+		{name: "ipv6 cidr", rule: "deny fd00::/8", peer: alice, dest: Destination{IP: net.ParseIP("fd12::1"), Port: 22}, want: true},
+		{name: "ipv4 rule ipv6 destination", rule: "deny 127.0.0.1", peer: alice, dest: Destination{IP: net.ParseIP("::1"), Port: 22}},
+		{name: "domain", rule: "allow example.com", peer: alice, dest: Destination{FQDN: "example.com", Port: 443}, want: true},
+		{name: "subdomain", rule: "allow .example.com", peer: alice, dest: Destination{FQDN: "www.Example.COM.", Port: 443}, want: true},
+		{name: "domain suffix is not subdomain", rule: "allow example.com", peer: alice, dest: Destination{FQDN: "badexample.com", Port: 443}},
+		{name: "domain rule ip destination", rule: "allow example.com", peer: alice, dest: Destination{IP: net.ParseIP("93.184.216.34"), Port: 443}},
+		{name: "port", rule: "allow * ports=80,443", peer: alice, dest: Destination{FQDN: "example.com", Port: 443}, want: true},
+		{name: "other port", rule: "allow * ports=80,443", peer: alice, dest: Destination{FQDN: "example.com", Port: 8080}},
+		{name: "port range start", rule: "allow * ports=8000-8100", peer: alice, dest: Destination{FQDN: "example.com", Port: 8000}, want: true},
+		{name: "port range end", rule: "allow * ports=8000-8100", peer: alice, dest: Destination{FQDN: "example.com", Port: 8100}, want: true},
+		{name: "outside port range", rule: "allow * ports=8000-8100", peer: alice, dest: Destination{FQDN: "example.com", Port: 8101}},
+		{name: "peer", rule: "allow * peers=" + testPeerID, peer: alice, dest: Destination{FQDN: "example.com", Port: 80}, want: true},
+		{name: "other peer", rule: "allow * peers=" + testPeerID, peer: bob, dest: Destination{FQDN: "example.com", Port: 80}},
+		{name: "all conditions", rule: "allow .corp.example.com ports=1-1024 peers=" + otherPeerID, peer: bob, dest: Destination{FQDN: "git.corp.example.com", Port: 22}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := mustParseRule(t, tt.rule)
+			if got := rule.Matches(tt.peer, tt.dest); got != tt.want {
+				t.Errorf("%q Matches(%v) = %v, expected %v", tt.rule, tt.dest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestinationRulesAllowed(t *testing.T) {
+	alice, bob := mustDecodePeer(t, testPeerID), mustDecodePeer(t, otherPeerID)
+
+	rules := NewDestinationRules(
+		mustParseRule(t, "deny 169.254.169.254,10.0.0.0/8"),
+		mustParseRule(t, "allow .corp.example.com peers="+testPeerID),
+		mustParseRule(t, "deny .corp.example.com"),
+		mustParseRule(t, "allow * ports=80,443"),
+		mustParseRule(t, "deny *"),
+	)
+
+	tests := []struct {
+		name string
+		peer peer.ID
+		dest Destination
+		want bool
+		rule string // definition of the deciding rule
+	}{
+		{name: "deny before allow", peer: alice, dest: Destination{IP: net.ParseIP("10.0.0.1"), Port: 80}, rule: "deny 169.254.169.254,10.0.0.0/8"},
+		{name: "denied resolved name", peer: alice, dest: Destination{FQDN: "web.corp.example.com", IP: net.ParseIP("10.0.0.1"), Port: 443}, rule: "deny 169.254.169.254,10.0.0.0/8"},
+		{name: "allowed peer", peer: alice, dest: Destination{FQDN: "git.corp.example.com", Port: 22}, want: true, rule: "allow .corp.example.com peers=" + testPeerID},
+		{name: "other peer denied", peer: bob, dest: Destination{FQDN: "git.corp.example.com", Port: 443}, rule: "deny .corp.example.com"},
+		{name: "allowed port", peer: bob, dest: Destination{FQDN: "example.com", Port: 443}, want: true, rule: "allow * ports=80,443"},
+		{name: "catch-all deny", peer: bob, dest: Destination{FQDN: "example.com", Port: 22}, rule: "deny *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rule := rules.Allowed(tt.peer, tt.dest)
+			if got != tt.want {
+				t.Errorf("Allowed(%v) = %v, expected %v", tt.dest, got, tt.want)
+			}
+			if rule == nil || rule.String() != tt.rule {
+				t.Errorf("Allowed(%v) decided by %v, expected %q", tt.dest, rule, tt.rule)
+			}
+		})
+	}
+
+	t.Run("no matching rule", func(t *testing.T) {
+		rules := NewDestinationRules(mustParseRule(t, "deny 10.0.0.0/8"))
+		if got, rule := rules.Allowed(alice, Destination{FQDN: "example.com", Port: 80}); !got || rule != nil {
+			t.Errorf("Allowed = %v, %v, expected true, nil", got, rule)
+		}
+	})
+
+	t.Run("nil rules", func(t *testing.T) {
+		var rules *DestinationRules
+		if got, rule := rules.Allowed(alice, Destination{IP: net.ParseIP("10.0.0.1"), Port: 80}); !got || rule != nil {
+			t.Errorf("Allowed = %v, %v, expected true, nil", got, rule)
+		}
+	})
+}
+
+func TestDestinationRulesNameDenied(t *testing.T) {
+	alice, bob := mustDecodePeer(t, testPeerID), mustDecodePeer(t, otherPeerID)
+
+	tests := []struct {
+		name  string
+		rules []string
+		peer  peer.ID
+		fqdn  string
+		want  bool
+	}{
+		{name: "denied domain", rules: []string{"deny .example.com"}, peer: alice, fqdn: "www.example.com", want: true},
+		{name: "other domain", rules: []string{"deny .example.com"}, peer: alice, fqdn: "example.org"},
+		{name: "catch-all deny", rules: []string{"allow .example.com", "deny *"}, peer: alice, fqdn: "example.org", want: true},
+		{name: "allowed domain", rules: []string{"allow .example.com", "deny *"}, peer: alice, fqdn: "www.example.com"},
+		{name: "deny with ports", rules: []string{"deny .example.com ports=22"}, peer: alice, fqdn: "example.com"},
+		{name: "allow with ports before deny", rules: []string{"allow * ports=443", "deny *"}, peer: alice, fqdn: "example.com"},
+		{name: "network rule before deny", rules: []string{"allow 10.0.0.0/8", "deny .example.com"}, peer: alice, fqdn: "example.com"},
+		{name: "network rule after deny", rules: []string{"deny .example.com", "allow 10.0.0.0/8"}, peer: alice, fqdn: "example.com", want: true},
+		{name: "rule of other peer skipped", rules: []string{"allow * peers=" + testPeerID, "deny *"}, peer: bob, fqdn: "example.com", want: true},
+		{name: "rule of the peer", rules: []string{"allow * peers=" + testPeerID, "deny *"}, peer: alice, fqdn: "example.com"},
+		{name: "no rules", peer: alice, fqdn: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []DestinationRule
+			for _, def := range tt.rules {
+				rules = append(rules, mustParseRule(t, def))
+			}
+			if got, rule := NewDestinationRules(rules...).NameDenied(tt.peer, tt.fqdn); got != tt.want {
+				t.Errorf("NameDenied(%q) = %v, %v, expected %v", tt.fqdn, got, rule, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package p2p
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultBufferSize is the default size of buffers used to copy data between local connections and p2p streams.
+const DefaultBufferSize = 32 << 10
+
+// MaxBufferSize is the maximum size of buffers used to copy data, larger sizes are capped.
+const MaxBufferSize = 1 << 20
+
+// bufferPools are pools of copy buffers by buffer size.
+var bufferPools sync.Map
+
+func getBuffer(size int) *[]byte {
+	pool, ok := bufferPools.Load(size)
+	if !ok {
+		pool, _ = bufferPools.LoadOrStore(size, &sync.Pool{New: func() interface{} {
+			b := make([]byte, size)
+			return &b
+		}})
+	}
+	return pool.(*sync.Pool).Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if pool, ok := bufferPools.Load(len(*b)); ok {
+		pool.(*sync.Pool).Put(b)
+	}
+}
+
+// CopyBuffered copies from src to dst until either EOF is reached on src or an error occurs, using pooled buffer of
+// the given size (DefaultBufferSize if size is not positive, MaxBufferSize if size is larger). Unlike io.Copy it never uses io.WriterTo and
+// io.ReaderFrom of src and dst, which allocate new buffer on every call for most connection types.
+func CopyBuffered(dst io.Writer, src io.Reader, size int) (written int64, err error) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	} else if size > MaxBufferSize {
+		size = MaxBufferSize
+	}
+	bp := getBuffer(size)
+	defer putBuffer(bp)
+	buf := *bp
+
+	for {
+		nr, rErr := src.Read(buf)
+		if nr > 0 {
+			nw, wErr := dst.Write(buf[:nr])
+			if nw > 0 {
+				written += int64(nw)
+			}
+			if wErr != nil {
+				return written, wErr
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rErr != nil {
+			if rErr != io.EOF {
+				err = rErr
+			}
+			return written, err
+		}
+	}
+}
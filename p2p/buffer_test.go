@@ -0,0 +1,214 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+const benchProtocolID = "/bench/copy/0.0.1"
+
+// sessionSize is the number of bytes copied by every benchmarked session.
+const sessionSize = 256 << 10
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// newStreamFactory returns function that opens streams between two mocknet hosts, remote side discards everything.
+func newStreamFactory(ctx context.Context, b *testing.B) func() network.Stream {
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	hosts[1].SetStreamHandler(benchProtocolID, func(s network.Stream) {
+		_, _ = io.Copy(ioutil.Discard, s)
+		_ = s.Close()
+	})
+
+	return func() network.Stream {
+		s, err := hosts[0].NewStream(ctx, hosts[1].ID(), benchProtocolID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return s
+	}
+}
+
+func benchmarkSessions(b *testing.B, copyFn func(dst io.Writer, src io.Reader) (int64, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newStream := newStreamFactory(ctx, b)
+
+	b.SetBytes(sessionSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s := newStream()
+		if _, err := copyFn(s, io.LimitReader(zeroReader{}, sessionSize)); err != nil {
+			b.Fatal(err)
+		}
+		_ = s.Close()
+	}
+}
+
+// BenchmarkIOCopy is the copy path used before pooled buffers: io.Copy allocates new buffer for every session.
+func BenchmarkIOCopy(b *testing.B) {
+	benchmarkSessions(b, io.Copy)
+}
+
+func BenchmarkCopyBuffered(b *testing.B) {
+	for _, size := range []int{4 << 10, DefaultBufferSize, 128 << 10} {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			benchmarkSessions(b, func(dst io.Writer, src io.Reader) (int64, error) {
+				return CopyBuffered(dst, src, size)
+			})
+		})
+	}
+}
+
+// readSizeRecorder records the largest buffer passed to Read.
+type readSizeRecorder struct {
+	r       io.Reader
+	maxRead int
+}
+
+func (r *readSizeRecorder) Read(p []byte) (int, error) {
+	if len(p) > r.maxRead {
+		r.maxRead = len(p)
+	}
+	return r.r.Read(p)
+}
+
+// shortWriter writes at most n bytes of every write.
+type shortWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	return w.w.Write(p)
+}
+
+type errReader struct {
+	data []byte
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestCopyBufferedSize(t *testing.T) {
+	tests := []struct {
+		size     int
+		expected int
+	}{
+		{size: 0, expected: DefaultBufferSize},
+		{size: -1, expected: DefaultBufferSize},
+		{size: 4 << 10, expected: 4 << 10},
+		{size: MaxBufferSize, expected: MaxBufferSize},
+		{size: MaxBufferSize + 1, expected: MaxBufferSize},
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 2*MaxBufferSize/10)
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.size), func(t *testing.T) {
+			r := &readSizeRecorder{r: bytes.NewReader(data)}
+			var dst bytes.Buffer
+			n, err := CopyBuffered(&dst, r, tt.size)
+			if err != nil || n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+				t.Fatalf("CopyBuffered = %v, %v, expected %v, nil and equal data", n, err, len(data))
+			}
+			if r.maxRead != tt.expected {
+				t.Errorf("buffer size = %v, expected %v", r.maxRead, tt.expected)
+			}
+		})
+	}
+
+	if _, ok := bufferPools.Load(MaxBufferSize + 1); ok {
+		t.Errorf("pool of buffers larger than %v is created", MaxBufferSize)
+	}
+}
+
+func TestCopyBufferedErrors(t *testing.T) {
+	errRead, errWrite := errors.New("read failed"), errors.New("write failed")
+	tests := []struct {
+		name     string
+		dst      io.Writer
+		src      io.Reader
+		expected int64
+		err      error
+	}{
+		{name: "EOF", dst: ioutil.Discard, src: strings.NewReader("data"), expected: 4},
+		{name: "read error", dst: ioutil.Discard, src: &errReader{data: []byte("data"), err: errRead}, expected: 4, err: errRead},
+		{name: "write error", dst: errWriter{err: errWrite}, src: strings.NewReader("data"), err: errWrite},
+		{name: "short write", dst: shortWriter{w: ioutil.Discard, n: 2}, src: strings.NewReader("data"), expected: 2, err: io.ErrShortWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n, err := CopyBuffered(tt.dst, tt.src, 0); n != tt.expected || err != tt.err {
+				t.Errorf("CopyBuffered = %v, %v, expected %v, %v", n, err, tt.expected, tt.err)
+			}
+		})
+	}
+}
+
+func TestBufferPools(t *testing.T) {
+	sizes := []int{1 << 10, 4 << 10, DefaultBufferSize}
+
+	// buffers of different sizes are returned to pools concurrently, every pool must give out buffers of its size only
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				size := sizes[(i+j)%len(sizes)]
+				bp := getBuffer(size)
+				if len(*bp) != size {
+					t.Errorf("buffer size = %v, expected %v", len(*bp), size)
+				}
+				putBuffer(bp)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// buffer of size without pool is dropped instead of creating new pool
+	b := make([]byte, 3<<10)
+	putBuffer(&b)
+	if _, ok := bufferPools.Load(len(b)); ok {
+		t.Errorf("pool of %v bytes buffers is created by putBuffer", len(b))
+	}
+}
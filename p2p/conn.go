@@ -43,6 +43,11 @@ func (c *conn) Close() error {
 	return nil
 }
 
+// CloseWrite closes the stream for writing, reading still works until remote side closes the stream.
+func (c *conn) CloseWrite() error {
+	return c.s.Close()
+}
+
 // LocalAddr returns the local network address.
 func (c *conn) LocalAddr() net.Addr {
 	return &addr{c.s.Conn().LocalPeer()}
@@ -0,0 +1,125 @@
+package connlimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+var (
+	// ErrServiceLimit is returned when maximum number of concurrent sessions of the service is reached.
+	ErrServiceLimit = errors.New("maximum number of service sessions reached")
+	// ErrPeerLimit is returned when maximum number of concurrent sessions with the peer is reached.
+	ErrPeerLimit = errors.New("maximum number of peer sessions reached")
+)
+
+// Limits are caps of concurrent sessions, zero means unlimited.
+type Limits struct {
+	MaxSessions     int           // maximum number of concurrent sessions of the service
+	MaxPeerSessions int           // maximum number of concurrent sessions with the same peer
+	QueueTimeout    time.Duration // how long session waits for free slot, zero means excess sessions are rejected
+}
+
+// IsZero returns true if nothing is limited.
+func (l Limits) IsZero() bool {
+	return l.MaxSessions <= 0 && l.MaxPeerSessions <= 0
+}
+
+// Limiter limits number of concurrent sessions of single service. Nil limiter doesn't limit anything.
+type Limiter struct {
+	limits Limits
+
+	mu       sync.Mutex
+	sessions int
+	peers    map[peer.ID]int
+	released chan struct{} // closed and replaced every time session is released
+}
+
+// New returns limiter with the given limits, nil is returned if nothing is limited.
+func New(limits Limits) *Limiter {
+	if limits.IsZero() {
+		return nil
+	}
+	return &Limiter{
+		limits:   limits,
+		peers:    make(map[peer.ID]int),
+		released: make(chan struct{}),
+	}
+}
+
+// Acquire reserves slot for the session with the peer (empty peer ID means only service limit is checked). If there
+// is no free slot, it waits for one up to the queue timeout or until context is done. Returned function must be
+// called when session is finished.
+func (l *Limiter) Acquire(ctx context.Context, p peer.ID) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	var timeout <-chan time.Time
+	if l.limits.QueueTimeout > 0 {
+		t := time.NewTimer(l.limits.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for {
+		released, err := l.tryAcquire(p)
+		if err == nil {
+			return l.releaseFunc(p), nil
+		}
+		if timeout == nil {
+			return nil, err
+		}
+
+		select {
+		case <-released:
+		case <-timeout:
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryAcquire reserves slot for the session with the peer if there is free one, otherwise it returns the error and
+// channel that is closed when some session is released.
+func (l *Limiter) tryAcquire(p peer.ID) (released <-chan struct{}, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.MaxSessions > 0 && l.sessions >= l.limits.MaxSessions {
+		return l.released, ErrServiceLimit
+	}
+	if p != "" && l.limits.MaxPeerSessions > 0 && l.peers[p] >= l.limits.MaxPeerSessions {
+		return l.released, ErrPeerLimit
+	}
+
+	l.sessions++
+	if p != "" {
+		l.peers[p]++
+	}
+	return nil, nil
+}
+
+func (l *Limiter) releaseFunc(p peer.ID) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.sessions--
+			if p != "" {
+				if l.peers[p]--; l.peers[p] == 0 {
+					delete(l.peers, p)
+				}
+			}
+
+			close(l.released)
+			l.released = make(chan struct{})
+		})
+	}
+}
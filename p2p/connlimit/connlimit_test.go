@@ -0,0 +1,186 @@
+package connlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	alice = peer.ID("alice")
+	bob   = peer.ID("bob")
+)
+
+type acquireResult struct {
+	release func()
+	err     error
+}
+
+// acquireAsync calls Acquire in background and returns channel of its result.
+func acquireAsync(ctx context.Context, l *Limiter, p peer.ID) <-chan acquireResult {
+	ch := make(chan acquireResult, 1)
+	go func() {
+		release, err := l.Acquire(ctx, p)
+		ch <- acquireResult{release: release, err: err}
+	}()
+	return ch
+}
+
+// mustAcquire acquires session slot or fails the test.
+func mustAcquire(t *testing.T, l *Limiter, p peer.ID) func() {
+	t.Helper()
+
+	release, err := l.Acquire(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Acquire(%v) failed: %v", p, err)
+	}
+	return release
+}
+
+func TestNew(t *testing.T) {
+	if l := New(Limits{QueueTimeout: time.Second}); l != nil {
+		t.Errorf("New() = %v, expected nil limiter without limits", l)
+	}
+
+	var l *Limiter
+	release, err := l.Acquire(context.Background(), alice)
+	if err != nil {
+		t.Fatalf("nil limiter Acquire failed: %v", err)
+	}
+	release()
+}
+
+func TestAcquireRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		first   peer.ID
+		second  peer.ID
+		wantErr error
+	}{
+		{name: "service limit", limits: Limits{MaxSessions: 1}, first: alice, second: bob, wantErr: ErrServiceLimit},
+		{name: "peer limit", limits: Limits{MaxPeerSessions: 1}, first: alice, second: alice, wantErr: ErrPeerLimit},
+		{name: "service limit without peer", limits: Limits{MaxSessions: 1}, first: "", second: "", wantErr: ErrServiceLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.limits)
+			release := mustAcquire(t, l, tt.first)
+
+			if _, err := l.Acquire(context.Background(), tt.second); err != tt.wantErr {
+				t.Fatalf("second Acquire error = %v, expected %v", err, tt.wantErr)
+			}
+
+			release()
+			mustAcquire(t, l, tt.second)()
+		})
+	}
+
+	t.Run("other peer is not limited by peer limit", func(t *testing.T) {
+		l := New(Limits{MaxPeerSessions: 1})
+		defer mustAcquire(t, l, alice)()
+		mustAcquire(t, l, bob)()
+	})
+
+	t.Run("empty peer is not limited by peer limit", func(t *testing.T) {
+		l := New(Limits{MaxPeerSessions: 1})
+		defer mustAcquire(t, l, "")()
+		mustAcquire(t, l, "")()
+	})
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		second peer.ID
+	}{
+		{name: "service limit", limits: Limits{MaxSessions: 1, QueueTimeout: 5 * time.Second}, second: bob},
+		{name: "peer limit", limits: Limits{MaxPeerSessions: 1, QueueTimeout: 5 * time.Second}, second: alice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.limits)
+			release := mustAcquire(t, l, alice)
+
+			resCh := acquireAsync(context.Background(), l, tt.second)
+			select {
+			case res := <-resCh:
+				t.Fatalf("second Acquire is not blocked: %v", res.err)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			release()
+			select {
+			case res := <-resCh:
+				if res.err != nil {
+					t.Fatalf("second Acquire failed after release: %v", res.err)
+				}
+				res.release()
+			case <-time.After(time.Second):
+				t.Fatal("second Acquire is blocked after release")
+			}
+		})
+	}
+}
+
+func TestAcquireQueueTimeout(t *testing.T) {
+	l := New(Limits{MaxSessions: 1, QueueTimeout: 50 * time.Millisecond})
+	defer mustAcquire(t, l, alice)()
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), bob); err != ErrServiceLimit {
+		t.Fatalf("Acquire error = %v, expected %v", err, ErrServiceLimit)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond || d > time.Second {
+		t.Errorf("Acquire failed in %v, expected after queue timeout", d)
+	}
+}
+
+func TestAcquireContextCancelled(t *testing.T) {
+	l := New(Limits{MaxSessions: 1, QueueTimeout: time.Minute})
+	defer mustAcquire(t, l, alice)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resCh := acquireAsync(ctx, l, bob)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case res := <-resCh:
+		if res.err != context.Canceled {
+			t.Errorf("Acquire error = %v, expected %v", res.err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire is blocked after context is cancelled")
+	}
+}
+
+func TestReleaseTwice(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr error
+	}{
+		{name: "service limit", limits: Limits{MaxSessions: 1}, wantErr: ErrServiceLimit},
+		{name: "peer limit", limits: Limits{MaxPeerSessions: 1}, wantErr: ErrPeerLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.limits)
+			release := mustAcquire(t, l, alice)
+			release()
+			defer mustAcquire(t, l, alice)()
+
+			release() // must not free the slot of the other session
+			if _, err := l.Acquire(context.Background(), alice); err != tt.wantErr {
+				t.Errorf("Acquire error = %v after repeated release, expected %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package control
+
+import "time"
+
+// API paths served over control socket.
+const (
+	peersPath    = "/v1/peers"
+	forwardsPath = "/v1/forwards"
+	servicesPath = "/v1/services"
+	sessionsPath = "/v1/sessions"
+	shutdownPath = "/v1/shutdown"
+)
+
+// PeerInfo describes connected peer.
+type PeerInfo struct {
+	ID    string   `json:"id"`
+	Addrs []string `json:"addrs"` // remote addresses of the connections to the peer
+}
+
+// ForwardInfo describes running forwarder.
+type ForwardInfo struct {
+	ID       int    `json:"id"`
+	Listen   string `json:"listen"`
+	Target   string `json:"target"`
+	Protocol string `json:"protocol"`
+	Sessions int    `json:"sessions"`
+}
+
+// ForwardRequest describes forwarder to start, exactly one of Target and Rendezvous must be specified.
+type ForwardRequest struct {
+	Listen     string `json:"listen"`
+	Target     string `json:"target,omitempty"`
+	Rendezvous string `json:"rendezvous,omitempty"`
+	Type       string `json:"type,omitempty"`    // target service type, defaults to portforwarder
+	Service    string `json:"service,omitempty"` // target portforwarder service name, empty means default service
+}
+
+// ServiceInfo describes p2p service exposed by the node.
+type ServiceInfo struct {
+	Type     string `json:"type"` // listen or socks5
+	Name     string `json:"name,omitempty"`
+	Protocol string `json:"protocol"`
+	Target   string `json:"target,omitempty"`
+}
+
+// SessionInfo describes active forwarding session.
+type SessionInfo struct {
+	ID        uint64    `json:"id"`
+	Service   string    `json:"service"`
+	Peer      string    `json:"peer"`
+	LocalAddr string    `json:"local_addr,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
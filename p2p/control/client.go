@@ -0,0 +1,106 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Client talks to control server over unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns client of the control server listening on the unix socket path.
+func NewClient(socketPath string) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Peers returns connected peers.
+func (c *Client) Peers(ctx context.Context) (res []PeerInfo, err error) {
+	err = c.do(ctx, http.MethodGet, peersPath, nil, &res)
+	return
+}
+
+// Forwards returns running forwarders.
+func (c *Client) Forwards(ctx context.Context) (res []ForwardInfo, err error) {
+	err = c.do(ctx, http.MethodGet, forwardsPath, nil, &res)
+	return
+}
+
+// AddForward starts new forwarder.
+func (c *Client) AddForward(ctx context.Context, req ForwardRequest) (res ForwardInfo, err error) {
+	err = c.do(ctx, http.MethodPost, forwardsPath, req, &res)
+	return
+}
+
+// RemoveForward stops forwarder with the given ID.
+func (c *Client) RemoveForward(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, forwardsPath+"/"+strconv.Itoa(id), nil, nil)
+}
+
+// Services returns p2p services exposed by the node.
+func (c *Client) Services(ctx context.Context) (res []ServiceInfo, err error) {
+	err = c.do(ctx, http.MethodGet, servicesPath, nil, &res)
+	return
+}
+
+// Sessions returns active forwarding sessions.
+func (c *Client) Sessions(ctx context.Context) (res []SessionInfo, err error) {
+	err = c.do(ctx, http.MethodGet, sessionsPath, nil, &res)
+	return
+}
+
+// Shutdown stops the node.
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, shutdownPath, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, reqBody, resBody interface{}) error {
+	var body bytes.Buffer
+	if reqBody != nil {
+		if err := json.NewEncoder(&body).Encode(reqBody); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, "http://unix"+path, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errResp errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			return fmt.Errorf("control API error: %v", resp.Status)
+		}
+		return fmt.Errorf("control API error: %v", errResp.Error)
+	}
+
+	if resBody == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(resBody)
+}
@@ -0,0 +1,400 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/forwarder"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/listener"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/session"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/socks5"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var logger = logging.Logger("control")
+
+// socketMode is the permissions of the control socket file, only the owner of the process can control the node.
+const socketMode = 0600
+
+// shutdownTimeout is the time server waits for active requests to finish on close.
+const shutdownTimeout = 5 * time.Second
+
+// ForwardFactory starts forwarder requested via control API.
+type ForwardFactory func(ctx context.Context, req ForwardRequest) (*forwarder.Forwarder, error)
+
+// Server serves control API over unix socket.
+type Server struct {
+	closeOnce sync.Once
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	h            host.Host
+	listener     manet.Listener
+	server       *http.Server
+	newForwarder ForwardFactory
+	shutdown     func()
+
+	mu            sync.Mutex
+	closed        bool // forwarders started after close are closed by request handler
+	lastForwardID int
+	forwarders    []forwarderEntry
+	listeners     []*listener.Listener
+	socks         []*socks5.Socks5
+}
+
+type forwarderEntry struct {
+	id    int
+	fwd   *forwarder.Forwarder
+	owned bool // forwarder is started via control API and is closed with server
+}
+
+// Option is a control server option.
+type Option func(s *Server)
+
+// WithForwardFactory enables starting of forwarders via control API.
+func WithForwardFactory(newForwarder ForwardFactory) Option {
+	return func(s *Server) { s.newForwarder = newForwarder }
+}
+
+// WithShutdown enables shutdown of the node via control API.
+func WithShutdown(shutdown func()) Option {
+	return func(s *Server) { s.shutdown = shutdown }
+}
+
+// New starts control server on the unix socket path.
+func New(ctx context.Context, h host.Host, socketPath string, opts ...Option) (*Server, error) {
+	socketAddr, err := unixAddr(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lst, err := p2p.ListenUnix(socketAddr, socketMode)
+	if err != nil {
+		return nil, err
+	}
+
+	serverCtx, ctxCancel := context.WithCancel(ctx)
+	s := &Server{
+		ctx:       serverCtx,
+		ctxCancel: ctxCancel,
+		h:         h,
+		listener:  lst,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(peersPath, s.handlePeers)
+	mux.HandleFunc(forwardsPath, s.handleForwards)
+	mux.HandleFunc(forwardsPath+"/", s.handleForward)
+	mux.HandleFunc(servicesPath, s.handleServices)
+	mux.HandleFunc(sessionsPath, s.handleSessions)
+	mux.HandleFunc(shutdownPath, s.handleShutdown)
+	s.server = &http.Server{Handler: mux}
+
+	async.Run(&s.wg, func() {
+		if err := s.server.Serve(manet.NetListener(lst)); err != nil && err != http.ErrServerClosed {
+			logger.Warningf("control server error: %v", err)
+		}
+	})
+
+	return s, nil
+}
+
+func unixAddr(path string) (multiaddr.Multiaddr, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return multiaddr.NewComponent("unix", absPath)
+}
+
+// AddForwarder registers forwarder started outside of control server and returns its ID.
+func (s *Server) AddForwarder(fwd *forwarder.Forwarder) int {
+	id, _ := s.addForwarder(fwd, false)
+	return id
+}
+
+// addForwarder registers forwarder and returns its ID, false is returned if server is closed.
+func (s *Server) addForwarder(fwd *forwarder.Forwarder, owned bool) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed && owned {
+		return 0, false
+	}
+
+	s.lastForwardID++
+	s.forwarders = append(s.forwarders, forwarderEntry{id: s.lastForwardID, fwd: fwd, owned: owned})
+	return s.lastForwardID, true
+}
+
+// AddListener registers listener.
+func (s *Server) AddListener(l *listener.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, l)
+}
+
+// AddSocks5 registers socks5 service.
+func (s *Server) AddSocks5(socks *socks5.Socks5) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.socks = append(s.socks, socks)
+}
+
+func (s *Server) Close() (err error) {
+	s.closeOnce.Do(func() {
+		err = s.close()
+	})
+	return
+}
+
+func (s *Server) close() error {
+	logger.Info("closing control server...")
+	defer logger.Info("control server closed.")
+
+	s.ctxCancel()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		_ = s.server.Close()
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, e := range s.forwarders {
+		if e.owned {
+			_ = e.fwd.Close()
+		}
+	}
+
+	return err
+}
+
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	network := s.h.Network()
+	peers := network.Peers()
+	res := make([]PeerInfo, 0, len(peers))
+	for _, id := range peers {
+		info := PeerInfo{ID: id.Pretty()}
+		for _, c := range network.ConnsToPeer(id) {
+			info.Addrs = append(info.Addrs, c.RemoteMultiaddr().String())
+		}
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleForwards(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		res := make([]ForwardInfo, 0, len(s.forwarders))
+		for _, e := range s.forwarders {
+			res = append(res, forwardInfo(e))
+		}
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, res)
+	case http.MethodPost:
+		if s.newForwarder == nil {
+			writeError(w, http.StatusNotImplemented, errors.New("starting forwarders is not supported"))
+			return
+		}
+
+		var req ForwardRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		fwd, err := s.newForwarder(s.ctx, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		id, ok := s.addForwarder(fwd, true)
+		if !ok {
+			_ = fwd.Close()
+			writeError(w, http.StatusServiceUnavailable, errors.New("control server is closing"))
+			return
+		}
+		logger.Infof("forwarder %d started: %v -> %v", id, fwd.ListenAddr(), fwd.Target())
+
+		writeJSON(w, http.StatusCreated, forwardInfo(forwarderEntry{id: id, fwd: fwd}))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) handleForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, forwardsPath+"/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid forward ID: %v", err))
+		return
+	}
+
+	fwd, found, owned := s.removeForwarder(id)
+	switch {
+	case !found:
+		writeError(w, http.StatusNotFound, fmt.Errorf("forward %d not found", id))
+		return
+	case !owned:
+		writeError(w, http.StatusForbidden, fmt.Errorf("forward %d is not started via control API", id))
+		return
+	}
+
+	if err := fwd.Close(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Infof("forwarder %d stopped", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeForwarder removes forwarder with the ID if it is started via control API, forwarders started from command line
+// can't be removed.
+func (s *Server) removeForwarder(id int) (fwd *forwarder.Forwarder, found, owned bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.forwarders {
+		if e.id == id {
+			if e.owned {
+				s.forwarders = append(s.forwarders[:i], s.forwarders[i+1:]...)
+			}
+			return e.fwd, true, e.owned
+		}
+	}
+	return nil, false, false
+}
+
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	s.mu.Lock()
+	res := make([]ServiceInfo, 0)
+	for _, l := range s.listeners {
+		for _, svc := range l.Services() {
+			res = append(res, ServiceInfo{
+				Type:     "listen",
+				Name:     svc.Name,
+				Protocol: string(svc.ProtocolID()),
+				Target:   svc.TargetAddr.String(),
+			})
+		}
+	}
+	for range s.socks {
+		res = append(res, ServiceInfo{Type: "socks5", Protocol: socks5.ID})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var sessions []session.Info
+	s.mu.Lock()
+	for _, e := range s.forwarders {
+		sessions = append(sessions, e.fwd.Sessions()...)
+	}
+	for _, l := range s.listeners {
+		sessions = append(sessions, l.Sessions()...)
+	}
+	for _, socks := range s.socks {
+		sessions = append(sessions, socks.Sessions()...)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	res := make([]SessionInfo, 0, len(sessions))
+	for _, info := range sessions {
+		res = append(res, SessionInfo{
+			ID:        info.ID,
+			Service:   info.Service,
+			Peer:      info.Peer.Pretty(),
+			LocalAddr: info.LocalAddr,
+			Started:   info.Started,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if s.shutdown == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("shutdown is not supported"))
+		return
+	}
+
+	logger.Info("shutdown requested via control API")
+	w.WriteHeader(http.StatusNoContent)
+	s.shutdown()
+}
+
+func forwardInfo(e forwarderEntry) ForwardInfo {
+	return ForwardInfo{
+		ID:       e.id,
+		Listen:   e.fwd.ListenAddr().String(),
+		Target:   e.fwd.Target().String(),
+		Protocol: string(e.fwd.ProtocolID()),
+		Sessions: len(e.fwd.Sessions()),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,191 @@
+package control
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/forwarder"
+	"github.com/libp2p/go-libp2p-core/host"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const testProtocolID = "/test/forward"
+
+// testForwardFactory starts forwarders to the target peer on the node.
+func testForwardFactory(h host.Host) ForwardFactory {
+	return func(ctx context.Context, req ForwardRequest) (*forwarder.Forwarder, error) {
+		listenAddr, err := multiaddr.NewMultiaddr(req.Listen)
+		if err != nil {
+			return nil, err
+		}
+		targetAddr, err := multiaddr.NewMultiaddr(req.Target)
+		if err != nil {
+			return nil, err
+		}
+		target, err := forwarder.PeerTarget(targetAddr)
+		if err != nil {
+			return nil, err
+		}
+		return forwarder.New(ctx, h, listenAddr, target, testProtocolID)
+	}
+}
+
+// newTestServer starts control server of one of mocked hosts with forward factory and returns the server, its client
+// and p2p address of the other host.
+func newTestServer(t *testing.T, ctx context.Context, opts ...Option) (*Server, *Client, string) {
+	t.Helper()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = os.RemoveAll(dir)
+	}()
+	socketPath := filepath.Join(dir, "control.sock")
+
+	s, err := New(ctx, hosts[0], socketPath, append([]Option{WithForwardFactory(testForwardFactory(hosts[0]))}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := hosts[1].Addrs()[0].String() + "/ipfs/" + hosts[1].ID().Pretty()
+	return s, NewClient(socketPath), target
+}
+
+// status sends request without body to control server and returns response status code.
+func status(t *testing.T, c *Client, method, path string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "http://unix"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func forwardIDs(t *testing.T, ctx context.Context, c *Client) []int {
+	t.Helper()
+
+	forwards, err := c.Forwards(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int, 0, len(forwards))
+	for _, f := range forwards {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestForwards(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, c, target := newTestServer(t, ctx)
+	defer func() { _ = s.Close() }()
+
+	// forwarder started from command line
+	static, err := testForwardFactory(s.h)(ctx, ForwardRequest{Listen: "/ip4/127.0.0.1/tcp/0", Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = static.Close() }()
+	staticID := s.AddForwarder(static)
+
+	req := ForwardRequest{Listen: "/ip4/127.0.0.1/tcp/0", Target: target}
+	added, err := c.AddForward(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID == staticID || added.Listen != req.Listen || added.Target != req.Target || added.Protocol != testProtocolID {
+		t.Errorf("added forward = %+v, expected new forward of %+v", added, req)
+	}
+	if _, err := c.AddForward(ctx, ForwardRequest{Listen: "invalid", Target: target}); err == nil {
+		t.Error("forward with invalid listen address is added")
+	}
+
+	if ids, expected := forwardIDs(t, ctx, c), []int{staticID, added.ID}; !equalIDs(ids, expected) {
+		t.Errorf("forwards = %v, expected %v", ids, expected)
+	}
+
+	// forwarder started from command line can't be removed
+	if err := c.RemoveForward(ctx, staticID); err == nil {
+		t.Error("forward started from command line is removed")
+	}
+	if code := status(t, c, http.MethodDelete, forwardsPath+"/"+strconv.Itoa(staticID)); code != http.StatusForbidden {
+		t.Errorf("status of removing forward started from command line = %v, expected %v", code, http.StatusForbidden)
+	}
+
+	if err := c.RemoveForward(ctx, added.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ids, expected := forwardIDs(t, ctx, c), []int{staticID}; !equalIDs(ids, expected) {
+		t.Errorf("forwards after remove = %v, expected %v", ids, expected)
+	}
+	if err := c.RemoveForward(ctx, added.ID); err == nil {
+		t.Error("removed forward is removed again")
+	}
+}
+
+func TestForwardsStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, c, _ := newTestServer(t, ctx)
+	defer func() { _ = s.Close() }()
+	noFactory, noFactoryClient, _ := newTestServer(t, ctx, WithForwardFactory(nil))
+	defer func() { _ = noFactory.Close() }()
+
+	tests := []struct {
+		name     string
+		c        *Client
+		method   string
+		path     string
+		expected int
+	}{
+		{name: "list", c: c, method: http.MethodGet, path: forwardsPath, expected: http.StatusOK},
+		{name: "add without body", c: c, method: http.MethodPost, path: forwardsPath, expected: http.StatusBadRequest},
+		{name: "add not supported", c: noFactoryClient, method: http.MethodPost, path: forwardsPath, expected: http.StatusNotImplemented},
+		{name: "remove unknown", c: c, method: http.MethodDelete, path: forwardsPath + "/42", expected: http.StatusNotFound},
+		{name: "remove invalid ID", c: c, method: http.MethodDelete, path: forwardsPath + "/abc", expected: http.StatusBadRequest},
+		{name: "get forward", c: c, method: http.MethodGet, path: forwardsPath + "/1", expected: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := status(t, tt.c, tt.method, tt.path); code != tt.expected {
+				t.Errorf("status of %v %v = %v, expected %v", tt.method, tt.path, code, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package p2p
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// CloseReason is a reason the forwarding session was closed.
+type CloseReason string
+
+// Close reasons of forwarding sessions.
+const (
+	LocalClosed  CloseReason = "local_closed"  // local connection was closed (client for forwarder, target for listener)
+	RemoteClosed CloseReason = "remote_closed" // p2p stream was closed
+	Shutdown     CloseReason = "shutdown"      // service is closing
+	IdleTimeout  CloseReason = "idle_timeout"  // no data was transferred during idle timeout
+	MaxLifetime  CloseReason = "max_lifetime"  // session lasted for maximum lifetime
+	Closed       CloseReason = "closed"        // both sides finished
+	Forbidden    CloseReason = "forbidden"     // request was rejected by access rules
+	Error        CloseReason = "error"         // session failed with error
+)
+
+// CopyResult describes finished duplex copy.
+type CopyResult struct {
+	In          int64 // bytes copied from remote to local
+	Out         int64 // bytes copied from local to remote
+	CloseReason CloseReason
+}
+
+// CopyOption is an option of FullDuplexCopy and DatagramDuplexCopy.
+type CopyOption func(c *copyConfig)
+
+type copyConfig struct {
+	countIn  func(n int64) // called with number of bytes copied from remote to local
+	countOut func(n int64) // called with number of bytes copied from local to remote
+	limitIn  RateLimiter   // limits rate of bytes copied from remote to local
+	limitOut RateLimiter   // limits rate of bytes copied from local to remote
+
+	idleTimeout time.Duration // session is closed if no bytes are copied in any direction during the timeout
+	maxLifetime time.Duration // session is closed when it lasts for the duration
+
+	bufferSize int // size of pooled copy buffers
+}
+
+// RateLimiter limits rate of copied bytes.
+type RateLimiter interface {
+	// WaitN blocks until n bytes can be copied or context is done.
+	WaitN(ctx context.Context, n int) error
+}
+
+func newCopyConfig(opts []CopyOption) *copyConfig {
+	c := &copyConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithByteCounters makes copy report number of bytes copied from remote to local (in) and from local to remote (out)
+// while copying, so long-lived sessions are accounted before they are finished.
+func WithByteCounters(in, out func(n int64)) CopyOption {
+	return func(c *copyConfig) {
+		c.countIn = in
+		c.countOut = out
+	}
+}
+
+// WithBufferSize sets size of pooled buffers used to copy stream data, DefaultBufferSize is used if size is not
+// positive.
+func WithBufferSize(size int) CopyOption {
+	return func(c *copyConfig) {
+		c.bufferSize = size
+	}
+}
+
+// WithIdleTimeout makes copy finish with IdleTimeout reason if no bytes are copied in any direction during the
+// timeout, zero means no timeout.
+func WithIdleTimeout(d time.Duration) CopyOption {
+	return func(c *copyConfig) {
+		c.idleTimeout = d
+	}
+}
+
+// WithMaxLifetime makes copy finish with MaxLifetime reason when it lasts for the duration, zero means unlimited.
+func WithMaxLifetime(d time.Duration) CopyOption {
+	return func(c *copyConfig) {
+		c.maxLifetime = d
+	}
+}
+
+// WithRateLimiters makes copy wait for the rate limiters before copying bytes from remote to local (in) and from
+// local to remote (out), nil limiter doesn't limit the direction.
+func WithRateLimiters(in, out RateLimiter) CopyOption {
+	return func(c *copyConfig) {
+		c.limitIn = in
+		c.limitOut = out
+	}
+}
+
+// waitN waits for the limiter (if any) before copying n bytes.
+func waitN(ctx context.Context, l RateLimiter, n int) error {
+	if l == nil {
+		return nil
+	}
+	return l.WaitN(ctx, n)
+}
+
+// limitingWriter waits for the rate limiter before writing to the underlying writer.
+type limitingWriter struct {
+	ctx context.Context
+	w   io.Writer
+	l   RateLimiter
+}
+
+func newLimitingWriter(ctx context.Context, w io.Writer, l RateLimiter) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &limitingWriter{ctx: ctx, w: w, l: l}
+}
+
+func (w *limitingWriter) Write(p []byte) (int, error) {
+	if err := w.l.WaitN(w.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// countingWriter reports number of bytes written to the underlying writer.
+type countingWriter struct {
+	w     io.Writer
+	count func(n int64)
+}
+
+func newCountingWriter(w io.Writer, count func(n int64)) io.Writer {
+	if count == nil {
+		return w
+	}
+	return &countingWriter{w: w, count: count}
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.count(int64(n))
+	}
+	return n, err
+}
+
+// sessionTimeouts tracks idle timeout and maximum lifetime of the copy.
+type sessionTimeouts struct {
+	idleTimeout   time.Duration
+	lastActivity  int64 // unix time in nanoseconds, accessed atomically
+	idleTimer     *time.Timer
+	lifetimeTimer *time.Timer
+}
+
+func newSessionTimeouts(c *copyConfig) *sessionTimeouts {
+	t := &sessionTimeouts{idleTimeout: c.idleTimeout}
+	if t.idleTimeout > 0 {
+		t.touch()
+		t.idleTimer = time.NewTimer(t.idleTimeout)
+	}
+	if c.maxLifetime > 0 {
+		t.lifetimeTimer = time.NewTimer(c.maxLifetime)
+	}
+	return t
+}
+
+// touch marks the session active.
+func (t *sessionTimeouts) touch() {
+	atomic.StoreInt64(&t.lastActivity, time.Now().UnixNano())
+}
+
+// idle returns channel that receives when session may be idle for idle timeout, nil channel is returned if there is
+// no idle timeout.
+func (t *sessionTimeouts) idle() <-chan time.Time {
+	if t.idleTimer == nil {
+		return nil
+	}
+	return t.idleTimer.C
+}
+
+// lifetime returns channel that receives when session lasts for maximum lifetime, nil channel is returned if lifetime
+// is unlimited.
+func (t *sessionTimeouts) lifetime() <-chan time.Time {
+	if t.lifetimeTimer == nil {
+		return nil
+	}
+	return t.lifetimeTimer.C
+}
+
+// idleExpired must be called when idle channel receives, it returns true if session is idle for idle timeout,
+// otherwise idle timer is rearmed.
+func (t *sessionTimeouts) idleExpired() bool {
+	idleFor := time.Since(time.Unix(0, atomic.LoadInt64(&t.lastActivity)))
+	if idleFor >= t.idleTimeout {
+		return true
+	}
+	t.idleTimer.Reset(t.idleTimeout - idleFor)
+	return false
+}
+
+func (t *sessionTimeouts) stop() {
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+	}
+	if t.lifetimeTimer != nil {
+		t.lifetimeTimer.Stop()
+	}
+}
+
+// waitFinished waits until copying is finished, context is done or session timeouts expire and returns close reason.
+// Every direction channel receives once: true if the direction is finished and its EOF is propagated to the other
+// side, false if the direction failed or the other side can't be half-closed, so session must be aborted.
+func waitFinished(ctx context.Context, localRemoteCh, remoteLocalCh <-chan bool, t *sessionTimeouts) CloseReason {
+	for localRemoteCh != nil || remoteLocalCh != nil {
+		select {
+		case ok := <-localRemoteCh:
+			if !ok {
+				return RemoteClosed
+			}
+			localRemoteCh = nil
+		case ok := <-remoteLocalCh:
+			if !ok {
+				return LocalClosed
+			}
+			remoteLocalCh = nil
+		case <-ctx.Done():
+			return Shutdown
+		case <-t.idle():
+			if t.idleExpired() {
+				return IdleTimeout
+			}
+		case <-t.lifetime():
+			return MaxLifetime
+		}
+	}
+	return Closed
+}
+
+// activityWriter marks session active on every write.
+type activityWriter struct {
+	w io.Writer
+	t *sessionTimeouts
+}
+
+func newActivityWriter(w io.Writer, t *sessionTimeouts) io.Writer {
+	if t.idleTimeout <= 0 {
+		return w
+	}
+	return &activityWriter{w: w, t: t}
+}
+
+func (w *activityWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.t.touch()
+	}
+	return n, err
+}
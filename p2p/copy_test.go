@@ -0,0 +1,201 @@
+package p2p
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWaitFinished(t *testing.T) {
+	tests := []struct {
+		name                     string
+		localRemote, remoteLocal []bool // results sent to direction channels
+		cancel                   bool
+		expected                 CloseReason
+	}{
+		{name: "both directions finished", localRemote: []bool{true}, remoteLocal: []bool{true}, expected: Closed},
+		{name: "remote failed", localRemote: []bool{false}, expected: RemoteClosed},
+		{name: "local failed", remoteLocal: []bool{false}, expected: LocalClosed},
+		{name: "local failed after remote finished", localRemote: []bool{true}, remoteLocal: []bool{false}, expected: LocalClosed},
+		{name: "context done", cancel: true, expected: Shutdown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			localRemoteCh, remoteLocalCh := make(chan bool, 1), make(chan bool, 1)
+			for _, ok := range tt.localRemote {
+				localRemoteCh <- ok
+			}
+			for _, ok := range tt.remoteLocal {
+				remoteLocalCh <- ok
+			}
+			timeouts := newSessionTimeouts(newCopyConfig(nil))
+			defer timeouts.stop()
+
+			if reason := waitFinished(ctx, localRemoteCh, remoteLocalCh, timeouts); reason != tt.expected {
+				t.Errorf("close reason = %v, expected %v", reason, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []CopyOption
+		activeFor   time.Duration // session is touched during the duration
+		expected    CloseReason
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "idle",
+			opts:        []CopyOption{WithIdleTimeout(100 * time.Millisecond)},
+			expected:    IdleTimeout,
+			minDuration: 100 * time.Millisecond,
+			maxDuration: time.Second,
+		},
+		{
+			name:        "idle after activity",
+			opts:        []CopyOption{WithIdleTimeout(100 * time.Millisecond)},
+			activeFor:   400 * time.Millisecond,
+			expected:    IdleTimeout,
+			minDuration: 500 * time.Millisecond,
+			maxDuration: 1500 * time.Millisecond,
+		},
+		{
+			name:        "max lifetime",
+			opts:        []CopyOption{WithMaxLifetime(100 * time.Millisecond)},
+			expected:    MaxLifetime,
+			minDuration: 100 * time.Millisecond,
+			maxDuration: time.Second,
+		},
+		{
+			name:        "max lifetime of active session",
+			opts:        []CopyOption{WithIdleTimeout(100 * time.Millisecond), WithMaxLifetime(400 * time.Millisecond)},
+			activeFor:   time.Second,
+			expected:    MaxLifetime,
+			minDuration: 400 * time.Millisecond,
+			maxDuration: 900 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeouts := newSessionTimeouts(newCopyConfig(tt.opts))
+			defer timeouts.stop()
+
+			done := make(chan struct{})
+			defer close(done)
+			go touchFor(timeouts, tt.activeFor, done)
+
+			start := time.Now()
+			reason := waitFinished(context.Background(), make(chan bool), make(chan bool), timeouts)
+			if reason != tt.expected {
+				t.Errorf("close reason = %v, expected %v", reason, tt.expected)
+			}
+			if d := time.Since(start); d < tt.minDuration || d > tt.maxDuration {
+				t.Errorf("session lasted for %v, expected %v-%v", d, tt.minDuration, tt.maxDuration)
+			}
+		})
+	}
+}
+
+// touchFor marks session active every 20 ms during the duration or until done is closed.
+func touchFor(t *sessionTimeouts, d time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(d)
+	for {
+		select {
+		case <-ticker.C:
+			t.touch()
+		case <-deadline:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestFullDuplexCopyTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []CopyOption
+		sender      func(s *testSession) (w io.Writer, r io.Reader) // returns ends traffic is sent between
+		activeFor   time.Duration
+		expected    CloseReason
+		minDuration time.Duration
+	}{
+		{
+			name:        "idle after traffic from local",
+			opts:        []CopyOption{WithIdleTimeout(200 * time.Millisecond)},
+			sender:      func(s *testSession) (io.Writer, io.Reader) { return s.client, s.peer },
+			activeFor:   500 * time.Millisecond,
+			expected:    IdleTimeout,
+			minDuration: 600 * time.Millisecond, // last byte is sent after 450 ms
+		},
+		{
+			name:        "idle after traffic from remote",
+			opts:        []CopyOption{WithIdleTimeout(200 * time.Millisecond)},
+			sender:      func(s *testSession) (io.Writer, io.Reader) { return s.peer, s.client },
+			activeFor:   500 * time.Millisecond,
+			expected:    IdleTimeout,
+			minDuration: 600 * time.Millisecond, // last byte is sent after 450 ms
+		},
+		{
+			name:        "max lifetime of active session",
+			opts:        []CopyOption{WithIdleTimeout(200 * time.Millisecond), WithMaxLifetime(400 * time.Millisecond)},
+			sender:      func(s *testSession) (io.Writer, io.Reader) { return s.client, s.peer },
+			activeFor:   5 * time.Second,
+			expected:    MaxLifetime,
+			minDuration: 400 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			s := newTestSession(t, ctx, tt.opts...)
+			defer func() { _ = s.client.Close() }()
+
+			// sends single byte every 50 ms while session is active
+			w, r := tt.sender(s)
+			go func() {
+				buf := make([]byte, 1)
+				for time.Since(start) < tt.activeFor {
+					if _, err := w.Write(buf); err != nil {
+						return
+					}
+					if _, err := io.ReadFull(r, buf); err != nil {
+						return
+					}
+					time.Sleep(50 * time.Millisecond)
+				}
+			}()
+
+			res := s.wait(t)
+			if res.CloseReason != tt.expected {
+				t.Errorf("close reason = %v, expected %v", res.CloseReason, tt.expected)
+			}
+			if d := time.Since(start); d < tt.minDuration {
+				t.Errorf("session lasted for %v, expected at least %v", d, tt.minDuration)
+			}
+			if res.In+res.Out == 0 {
+				t.Error("no bytes are copied")
+			}
+			assertTornDown(t, s)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package p2p
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// MaxDatagramSize is the maximum size of datagram that can be sent over the stream.
+const MaxDatagramSize = 1<<16 - 1
+
+const datagramHeaderSize = 2
+
+// IsDatagramAddr returns true if the address is a datagram (UDP) address.
+func IsDatagramAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(multiaddr.P_UDP)
+	return err == nil
+}
+
+// DatagramProtocolID returns protocol ID the service with the given protocol ID uses to carry datagrams. Datagram
+// sessions have separate protocol IDs, so datagram end of the session can't be connected to stream one, as the framing
+// would be garbled.
+func DatagramProtocolID(id protocol.ID) protocol.ID {
+	return "/udp" + id
+}
+
+// WriteDatagram writes single datagram to the stream prefixed with its length (2 bytes, big-endian).
+func WriteDatagram(w io.Writer, datagram []byte) error {
+	if len(datagram) > MaxDatagramSize {
+		return fmt.Errorf("datagram is too large: %d bytes", len(datagram))
+	}
+
+	frame := make([]byte, datagramHeaderSize+len(datagram))
+	binary.BigEndian.PutUint16(frame, uint16(len(datagram)))
+	copy(frame[datagramHeaderSize:], datagram)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadDatagram reads single datagram written by WriteDatagram into the buffer and returns its size. It returns io.EOF
+// only if stream ends between datagrams, io.ErrUnexpectedEOF is returned for truncated datagram and io.ErrShortBuffer
+// if datagram doesn't fit into the buffer.
+func ReadDatagram(r io.Reader, buf []byte) (int, error) {
+	var header [datagramHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if size > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+
+	n, err := io.ReadFull(r, buf[:size])
+	if err == io.EOF {
+		// stream ended after the header, so the frame is truncated
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// DatagramDuplexCopy copies datagrams from connected datagram local connection to remote stream and vice versa, every
+// Read and Write of local connection transfers single datagram. Datagrams are framed inside the stream with
+// WriteDatagram. Returns number of datagram bytes copied in each direction and close reason.
+func DatagramDuplexCopy(ctx context.Context, local net.Conn, remote network.Stream, opts ...CopyOption) (res CopyResult) {
+	cfg := newCopyConfig(opts)
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timeouts := newSessionTimeouts(cfg)
+	defer timeouts.stop()
+	var wg sync.WaitGroup
+
+	// datagram sessions can't be half-closed, so finished direction always aborts the session
+	localRemoteCh := make(chan bool, 1)
+	async.Run(&wg, func() {
+		defer func() { localRemoteCh <- false }()
+		bp := getBuffer(MaxDatagramSize)
+		defer putBuffer(bp)
+		buf := *bp
+		for {
+			n, err := ReadDatagram(remote, buf)
+			if err != nil {
+				return
+			}
+			if err := waitN(copyCtx, cfg.limitIn, n); err != nil {
+				return
+			}
+			if _, err := local.Write(buf[:n]); err != nil {
+				return
+			}
+			res.In += int64(n)
+			timeouts.touch()
+			if cfg.countIn != nil {
+				cfg.countIn(int64(n))
+			}
+		}
+	})
+
+	remoteLocalCh := make(chan bool, 1)
+	async.Run(&wg, func() {
+		defer func() { remoteLocalCh <- false }()
+		bp := getBuffer(MaxDatagramSize)
+		defer putBuffer(bp)
+		buf := *bp
+		for {
+			n, err := local.Read(buf)
+			if err != nil {
+				return
+			}
+			if err := waitN(copyCtx, cfg.limitOut, n); err != nil {
+				return
+			}
+			if err := WriteDatagram(remote, buf[:n]); err != nil {
+				return
+			}
+			res.Out += int64(n)
+			timeouts.touch()
+			if cfg.countOut != nil {
+				cfg.countOut(int64(n))
+			}
+		}
+	})
+
+	res.CloseReason = waitFinished(ctx, localRemoteCh, remoteLocalCh, timeouts)
+
+	cancel() // stops waiting for rate limiters
+	_ = local.Close()
+	_ = remote.Reset()
+
+	wg.Wait()
+	return
+}
@@ -0,0 +1,79 @@
+package p2p
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDatagramRoundTrip(t *testing.T) {
+	datagrams := [][]byte{
+		[]byte("query"),
+		{},
+		bytes.Repeat([]byte{0xab}, MaxDatagramSize),
+		[]byte("last"),
+	}
+
+	var stream bytes.Buffer
+	for _, d := range datagrams {
+		if err := WriteDatagram(&stream, d); err != nil {
+			t.Fatalf("WriteDatagram(%v bytes) failed: %v", len(d), err)
+		}
+	}
+
+	buf := make([]byte, MaxDatagramSize)
+	for i, want := range datagrams {
+		n, err := ReadDatagram(&stream, buf)
+		if err != nil {
+			t.Fatalf("ReadDatagram #%d failed: %v", i, err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Errorf("datagram #%d = %v bytes, expected %v bytes", i, n, len(want))
+		}
+	}
+	if _, err := ReadDatagram(&stream, buf); err != io.EOF {
+		t.Errorf("ReadDatagram at the end of stream error = %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestWriteDatagramTooLarge(t *testing.T) {
+	var stream bytes.Buffer
+	if err := WriteDatagram(&stream, make([]byte, MaxDatagramSize+1)); err == nil {
+		t.Fatal("datagram larger than MaxDatagramSize is written")
+	}
+	if stream.Len() != 0 {
+		t.Errorf("%v bytes are written with oversized datagram", stream.Len())
+	}
+}
+
+func TestReadDatagram(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  []byte
+		bufSize int
+		want    string
+		wantErr error
+	}{
+		{name: "datagram", stream: []byte{0, 4, 'p', 'i', 'n', 'g'}, bufSize: 16, want: "ping"},
+		{name: "buffer of datagram size", stream: []byte{0, 4, 'p', 'i', 'n', 'g'}, bufSize: 4, want: "ping"},
+		{name: "zero length", stream: []byte{0, 0, 'n', 'e', 'x', 't'}, bufSize: 16, want: ""},
+		{name: "short buffer", stream: []byte{0, 4, 'p', 'i', 'n', 'g'}, bufSize: 3, wantErr: io.ErrShortBuffer},
+		{name: "empty stream", bufSize: 16, wantErr: io.EOF},
+		{name: "truncated header", stream: []byte{0}, bufSize: 16, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated datagram", stream: []byte{0, 10, 'p', 'i', 'n', 'g'}, bufSize: 16, wantErr: io.ErrUnexpectedEOF},
+		{name: "header only", stream: []byte{0, 10}, bufSize: 16, wantErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.bufSize)
+			n, err := ReadDatagram(bytes.NewReader(tt.stream), buf)
+			if err != tt.wantErr {
+				t.Fatalf("ReadDatagram(%v) error = %v, expected %v", tt.stream, err, tt.wantErr)
+			}
+			if err == nil && string(buf[:n]) != tt.want {
+				t.Errorf("ReadDatagram(%v) = %q, expected %q", tt.stream, buf[:n], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/strutil"
+)
+
+var logger = logging.Logger("dns")
+
+const (
+	// DefaultPort is the port of DNS server used if server address has no port.
+	DefaultPort = "53"
+	// DefaultTimeout is the default timeout of single name resolution.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config describes how domain names are resolved.
+type Config struct {
+	Servers []string          // DNS servers (host[:port]) used for names not matching any rule, empty means system resolver
+	Rules   []Rule            // split-horizon rules
+	Hosts   map[string]net.IP // static host overrides
+	Timeout time.Duration     // timeout of single name resolution, DefaultTimeout is used if not positive
+}
+
+// Rule makes names matching the domain suffix resolved by the DNS servers.
+type Rule struct {
+	Domain  string   // domain suffix, matches the domain and all its subdomains
+	Servers []string // DNS servers (host[:port])
+}
+
+// Resolver resolves domain names by the static hosts, the DNS servers of the most specific matching rule or default
+// DNS servers, in this order.
+type Resolver struct {
+	hosts   map[string]net.IP
+	rules   []rule   // sorted from the most specific domain
+	def     []server // system resolver is used if empty
+	timeout time.Duration
+}
+
+type rule struct {
+	domain  string
+	servers []server
+}
+
+type server struct {
+	addr     string
+	resolver *net.Resolver
+}
+
+// New creates resolver with the config.
+func New(cfg Config) (*Resolver, error) {
+	r := &Resolver{
+		hosts:   make(map[string]net.IP, len(cfg.Hosts)),
+		timeout: cfg.Timeout,
+	}
+	if r.timeout <= 0 {
+		r.timeout = DefaultTimeout
+	}
+
+	for name, ip := range cfg.Hosts {
+		if ip == nil {
+			return nil, fmt.Errorf("no IP address of host '%v'", name)
+		}
+		r.hosts[normalize(name)] = ip
+	}
+
+	var err error
+	if r.def, err = newServers(cfg.Servers); err != nil {
+		return nil, err
+	}
+
+	for _, cr := range cfg.Rules {
+		domain := strings.TrimPrefix(normalize(cr.Domain), ".")
+		if domain == "" {
+			return nil, errors.New("empty DNS rule domain")
+		}
+		if len(cr.Servers) == 0 {
+			return nil, fmt.Errorf("no DNS servers of domain '%v'", domain)
+		}
+		servers, err := newServers(cr.Servers)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rule{domain: domain, servers: servers})
+	}
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		return len(r.rules[i].domain) > len(r.rules[j].domain)
+	})
+
+	return r, nil
+}
+
+func newServers(addrs []string) ([]server, error) {
+	servers := make([]server, 0, len(addrs))
+	for _, addr := range addrs {
+		addr, err := serverAddr(addr)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server{addr: addr, resolver: newResolver(addr)})
+	}
+	return servers, nil
+}
+
+// serverAddr returns address of DNS server with default port if it is not specified.
+func serverAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), DefaultPort
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid DNS server address '%v', expected IP[:port]", addr)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// newResolver returns resolver sending all queries to the DNS server.
+func newResolver(addr string) *net.Resolver {
+	var dialer net.Dialer
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// LookupIP returns IP address of the host, IPv4 address is preferred. Nil resolver uses system resolver.
+func (r *Resolver) LookupIP(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	if r == nil {
+		return lookup(ctx, net.DefaultResolver, host, DefaultTimeout)
+	}
+
+	name := normalize(host)
+	if ip, ok := r.hosts[name]; ok {
+		logger.Debugf("resolved %v to %v by static host", host, ip)
+		return ip, nil
+	}
+
+	servers := r.servers(name)
+	if len(servers) == 0 {
+		return lookup(ctx, net.DefaultResolver, host, r.timeout)
+	}
+
+	var err error
+	for _, s := range servers {
+		var ip net.IP
+		if ip, err = lookup(ctx, s.resolver, host, r.timeout); err == nil {
+			logger.Debugf("resolved %v to %v by %v", host, ip, s.addr)
+			return ip, nil
+		}
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound || ctx.Err() != nil {
+			break
+		}
+		logger.Debugf("failed to resolve %v by %v: %v", host, s.addr, err)
+	}
+	return nil, err
+}
+
+// servers returns DNS servers the name is resolved by.
+func (r *Resolver) servers(name string) []server {
+	for _, rl := range r.rules {
+		if name == rl.domain || strings.HasSuffix(name, "."+rl.domain) {
+			return rl.servers
+		}
+	}
+	return r.def
+}
+
+func lookup(ctx context.Context, resolver *net.Resolver, host string, timeout time.Duration) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs[0].IP, nil
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// ParseRule parses split-horizon rule definition: <domain>=<server>[,<server>...].
+func ParseRule(s string) (Rule, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return Rule{}, fmt.Errorf("invalid DNS rule '%v', expected: <domain>=<server>[,<server>...]", s)
+	}
+	return Rule{Domain: strings.TrimSpace(kv[0]), Servers: strutil.SplitList(kv[1])}, nil
+}
+
+// ParseHost parses static host definition: <name>=<ip>.
+func ParseHost(s string) (string, net.IP, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return "", nil, fmt.Errorf("invalid host '%v', expected: <name>=<ip>", s)
+	}
+	ip := net.ParseIP(strings.TrimSpace(kv[1]))
+	if ip == nil {
+		return "", nil, fmt.Errorf("invalid IP address of host '%v'", s)
+	}
+	return strings.TrimSpace(kv[0]), ip, nil
+}
@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		def     string
+		want    Rule
+		wantErr bool
+	}{
+		{def: "corp.example.com=10.0.0.53", want: Rule{Domain: "corp.example.com", Servers: []string{"10.0.0.53"}}},
+		{def: " .corp = 10.0.0.53:5353, [fd00::53]:53 ,", want: Rule{Domain: ".corp", Servers: []string{"10.0.0.53:5353", "[fd00::53]:53"}}},
+		{def: "corp=", want: Rule{Domain: "corp"}},
+		{def: "corp", wantErr: true},
+		{def: "=10.0.0.53", wantErr: true},
+		{def: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.def, func(t *testing.T) {
+			got, err := ParseRule(tt.def)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRule(%q) = %+v, expected error", tt.def, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule(%q) failed: %v", tt.def, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRule(%q) = %+v, expected %+v", tt.def, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		def     string
+		name    string
+		ip      string
+		wantErr bool
+	}{
+		{def: "db.local=10.0.0.5", name: "db.local", ip: "10.0.0.5"},
+		{def: " db.local = fd00::5 ", name: "db.local", ip: "fd00::5"},
+		{def: "db.local=db", wantErr: true},
+		{def: "db.local", wantErr: true},
+		{def: "=10.0.0.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.def, func(t *testing.T) {
+			name, ip, err := ParseHost(tt.def)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseHost(%q) = %v, %v, expected error", tt.def, name, ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseHost(%q) failed: %v", tt.def, err)
+			}
+			if name != tt.name || !ip.Equal(net.ParseIP(tt.ip)) {
+				t.Errorf("ParseHost(%q) = %v, %v, expected %v, %v", tt.def, name, ip, tt.name, tt.ip)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "servers", cfg: Config{Servers: []string{"1.1.1.1", "[2606:4700::1111]:53"}}},
+		{name: "invalid server", cfg: Config{Servers: []string{"dns.example.com"}}, wantErr: true},
+		{name: "empty rule domain", cfg: Config{Rules: []Rule{{Domain: ".", Servers: []string{"10.0.0.53"}}}}, wantErr: true},
+		{name: "rule without servers", cfg: Config{Rules: []Rule{{Domain: "corp"}}}, wantErr: true},
+		{name: "host without IP", cfg: Config{Hosts: map[string]net.IP{"db.local": nil}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New(%+v) error = %v, expected error %v", tt.cfg, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolverServers(t *testing.T) {
+	r, err := New(Config{
+		Servers: []string{"1.1.1.1"},
+		Rules: []Rule{
+			{Domain: "corp.example.com", Servers: []string{"10.0.0.53"}},
+			{Domain: ".dev.corp.example.com.", Servers: []string{"10.1.0.53:5353", "10.1.0.54"}},
+			{Domain: "internal", Servers: []string{"fd00::53"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "corp.example.com", want: []string{"10.0.0.53:53"}},
+		{name: "git.corp.example.com", want: []string{"10.0.0.53:53"}},
+		{name: "dev.corp.example.com", want: []string{"10.1.0.53:5353", "10.1.0.54:53"}},
+		{name: "ci.dev.corp.example.com", want: []string{"10.1.0.53:5353", "10.1.0.54:53"}},
+		{name: "db.internal", want: []string{"[fd00::53]:53"}},
+		{name: "mycorp.example.com", want: []string{"1.1.1.1:53"}},
+		{name: "example.com", want: []string{"1.1.1.1:53"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range r.servers(tt.name) {
+				got = append(got, s.addr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("servers(%q) = %v, expected %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if servers := (&Resolver{}).servers("example.com"); len(servers) != 0 {
+		t.Errorf("resolver without servers returned %v, expected system resolver", servers)
+	}
+}
+
+func TestResolverLookupStatic(t *testing.T) {
+	// servers are unreachable, so only names resolved without queries succeed
+	r, err := New(Config{
+		Servers: []string{"127.0.0.1:1"},
+		Hosts:   map[string]net.IP{"DB.Local.": net.ParseIP("10.0.0.5")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "db.local", want: "10.0.0.5"},
+		{host: "DB.LOCAL.", want: "10.0.0.5"},
+		{host: "192.168.1.1", want: "192.168.1.1"},
+		{host: "fd00::1", want: "fd00::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			ip, err := r.LookupIP(ctx, tt.host)
+			if err != nil || !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("LookupIP(%q) = %v, %v, expected %v", tt.host, ip, err, tt.want)
+			}
+		})
+	}
+
+	var nilResolver *Resolver
+	if ip, err := nilResolver.LookupIP(ctx, "10.0.0.1"); err != nil || !ip.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("nil resolver LookupIP = %v, %v, expected 10.0.0.1", ip, err)
+	}
+}
@@ -2,17 +2,23 @@ package forwarder
 
 import (
 	"context"
+	"net"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/metrics"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/session"
 	tec "github.com/jbenet/go-temp-err-catcher"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr-net"
@@ -27,39 +33,94 @@ type Forwarder struct {
 	wg        sync.WaitGroup
 
 	h                host.Host
-	listener         manet.Listener // listener accepts connections
-	targetPeerAddr   peer.AddrInfo  // and forwards them to targetPeerAddr
-	targetProtocolID protocol.ID    // using specified protocol ID
-}
+	bindAddr         multiaddr.Multiaddr
+	service          string           // service name used in sessions and metrics
+	listener         manet.Listener   // listener accepts connections
+	packetConn       manet.PacketConn // or packetConn receives datagrams
+	target           Target           // and forwards them to target peer
+	targetProtocolID protocol.ID      // using specified protocol ID
 
-func New(ctx context.Context, h host.Host, bindAddr multiaddr.Multiaddr, targetAddr multiaddr.Multiaddr, protocolID protocol.ID) (forwarder *Forwarder, err error) {
-	targetPeerAddr, err := peer.AddrInfoFromP2pAddr(targetAddr)
-	if err != nil {
-		return
-	}
+	udpIdleTimeout time.Duration
+	udpSessions    udpSessions
+	unixSocketMode os.FileMode
+	idleTimeout    time.Duration // idle timeout of stream sessions
+	maxLifetime    time.Duration // maximum lifetime of stream and datagram sessions
+	bufferSize     int           // size of stream copy buffers
+	connHandler    ConnHandler   // forwards stream sessions
 
-	h.Peerstore().AddAddrs(targetPeerAddr.ID, targetPeerAddr.Addrs, peerstore.TempAddrTTL)
+	sessions    session.Sessions
+	accessLog   *accesslog.Logger
+	rateLimiter *ratelimit.Limiter
 
-	maListener, err := manet.Listen(bindAddr)
-	if err != nil {
-		return
-	}
+	sessionLimits  connlimit.Limits
+	sessionLimiter *connlimit.Limiter
+}
 
+func New(ctx context.Context, h host.Host, bindAddr multiaddr.Multiaddr, target Target, protocolID protocol.ID, opts ...Option) (forwarder *Forwarder, err error) {
 	forwarderCtx, ctxCancel := context.WithCancel(ctx)
 	forwarder = &Forwarder{
 		ctx:              forwarderCtx,
 		ctxCancel:        ctxCancel,
 		h:                h,
-		listener:         maListener,
-		targetPeerAddr:   *targetPeerAddr,
+		bindAddr:         bindAddr,
+		service:          "forward " + bindAddr.String(),
+		target:           target,
 		targetProtocolID: protocolID,
+		udpIdleTimeout:   DefaultUDPIdleTimeout,
+		unixSocketMode:   DefaultUnixSocketMode,
+		udpSessions:      udpSessions{sessions: make(map[string]*udpSession)},
+		connHandler:      p2p.FullDuplexCopy,
+	}
+	for _, opt := range opts {
+		opt(forwarder)
 	}
+	forwarder.sessionLimiter = connlimit.New(forwarder.sessionLimits)
 
-	forwarder.acceptConnectionsAsync()
+	if p2p.IsDatagramAddr(bindAddr) {
+		forwarder.targetProtocolID = p2p.DatagramProtocolID(protocolID)
+		if forwarder.packetConn, err = manet.ListenPacket(bindAddr); err != nil {
+			ctxCancel()
+			return nil, err
+		}
+		forwarder.serveDatagramsAsync()
+	} else {
+		if forwarder.listener, err = forwarder.listen(bindAddr); err != nil {
+			ctxCancel()
+			return nil, err
+		}
+		forwarder.acceptConnectionsAsync()
+	}
 
 	return
 }
 
+func (f *Forwarder) listen(bindAddr multiaddr.Multiaddr) (manet.Listener, error) {
+	if p2p.IsUnixAddr(bindAddr) {
+		return p2p.ListenUnix(bindAddr, f.unixSocketMode)
+	}
+	return manet.Listen(bindAddr)
+}
+
+// ListenAddr returns address forwarder accepts connections on.
+func (f *Forwarder) ListenAddr() multiaddr.Multiaddr {
+	return f.bindAddr
+}
+
+// Target returns target peer connections are forwarded to.
+func (f *Forwarder) Target() Target {
+	return f.target
+}
+
+// ProtocolID returns protocol ID of the target peer service.
+func (f *Forwarder) ProtocolID() protocol.ID {
+	return f.targetProtocolID
+}
+
+// Sessions returns active forwarding sessions.
+func (f *Forwarder) Sessions() []session.Info {
+	return f.sessions.List()
+}
+
 func (f *Forwarder) Close() (err error) {
 	f.closeOnce.Do(func() {
 		err = f.close()
@@ -71,7 +132,12 @@ func (f *Forwarder) close() error {
 	logger.Info("closing forwarder...")
 	defer logger.Info("forwarder closed.")
 
-	_ = f.listener.Close()
+	if f.listener != nil {
+		_ = f.listener.Close()
+	}
+	if f.packetConn != nil {
+		_ = f.packetConn.Close()
+	}
 
 	f.ctxCancel()
 	f.wg.Wait()
@@ -104,6 +170,13 @@ func (f *Forwarder) handleStreamToTargetPeerAsync(local manet.Conn) {
 }
 
 func (f *Forwarder) handleStreamToTargetPeer(local manet.Conn) {
+	releaseSession, err := f.acquireSession(local.RemoteAddr())
+	if err != nil {
+		_ = local.Close()
+		return
+	}
+	defer releaseSession()
+
 	remote, err := f.newStreamToTargetPeer()
 	if err != nil {
 		logger.Warningf("failed to create stream to target peer: %v", err)
@@ -112,18 +185,75 @@ func (f *Forwarder) handleStreamToTargetPeer(local manet.Conn) {
 	}
 
 	remoteConn := remote.Conn()
+	defer f.addSession(remoteConn.RemotePeer(), local.RemoteAddr())()
+
 	logger.Debugf("forwarding %v to %v (%v)...", local.RemoteAddr(), remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr())
-	defer logger.Debugf("stopped forwarding %v to %v (%v).", local.RemoteAddr(), remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr())
-	p2p.FullDuplexCopy(f.ctx, local, remote)
+	upload, download, releaseRate := f.rateLimiter.Session(remoteConn.RemotePeer())
+	defer releaseRate()
+
+	start := time.Now()
+	res := f.connHandler(f.ctx, local, remote,
+		p2p.WithByteCounters(metrics.ByteCounters(f.service)),
+		p2p.WithRateLimiters(download, upload),
+		p2p.WithIdleTimeout(f.idleTimeout),
+		p2p.WithMaxLifetime(f.maxLifetime),
+		p2p.WithBufferSize(f.bufferSize),
+	)
+	logger.Debugf("stopped forwarding %v to %v (%v): %v.", local.RemoteAddr(), remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr(), res.CloseReason)
+	f.logSession(start, remoteConn, local.RemoteAddr(), res)
+}
+
+// acquireSession reserves slot for the session from local client address, it waits for free slot up to the queue
+// timeout if maximum number of concurrent sessions is reached.
+func (f *Forwarder) acquireSession(srcAddr net.Addr) (release func(), err error) {
+	release, err = f.sessionLimiter.Acquire(f.ctx, "")
+	if err != nil {
+		logger.Warningf("session from %v rejected: %v", srcAddr, err)
+		metrics.StreamOpenFailed(f.service, metrics.LimitExceeded)
+	}
+	return
+}
+
+// logSession writes access log record of the finished session.
+func (f *Forwarder) logSession(start time.Time, remoteConn network.Conn, srcAddr net.Addr, res p2p.CopyResult) {
+	r := accesslog.SessionRecord(f.service, start, remoteConn, res)
+	r.LocalAddr = srcAddr.String()
+	r.Target = f.target.String()
+	r.Protocol = string(f.targetProtocolID)
+	f.accessLog.Log(r)
+}
+
+// addSession registers forwarding session from local client address to the target peer and returns function that
+// removes it.
+func (f *Forwarder) addSession(targetPeerID peer.ID, srcAddr net.Addr) (remove func()) {
+	finished := metrics.SessionStarted(f.service)
+	removeSession := f.sessions.Add(session.Info{
+		Service:   f.service,
+		Peer:      targetPeerID,
+		LocalAddr: srcAddr.String(),
+	})
+
+	return func() {
+		removeSession()
+		finished()
+	}
 }
 
 func (f *Forwarder) newStreamToTargetPeer() (network.Stream, error) {
 	ctx, cancel := context.WithTimeout(f.ctx, time.Second*30)
 	defer cancel()
 
-	if err := p2p.EnsureConnectedToPeer(ctx, f.h, f.targetPeerAddr); err != nil {
+	targetPeerID, err := f.target.Connect(ctx, f.h)
+	if err != nil {
+		metrics.StreamOpenFailed(f.service, metrics.ConnectFailureReason(ctx))
+		return nil, err
+	}
+
+	stream, err := f.h.NewStream(ctx, targetPeerID, f.targetProtocolID)
+	if err != nil {
+		metrics.StreamOpenFailed(f.service, metrics.ProtocolNegotiation)
 		return nil, err
 	}
 
-	return f.h.NewStream(ctx, f.targetPeerAddr.ID, f.targetProtocolID)
+	return stream, nil
 }
@@ -0,0 +1,98 @@
+package forwarder
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+	"github.com/libp2p/go-libp2p-core/network"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+const (
+	// DefaultUDPIdleTimeout is the default timeout after which idle UDP session is closed.
+	DefaultUDPIdleTimeout = time.Minute
+	// DefaultUnixSocketMode is the default permissions of unix domain socket file forwarder listens on.
+	DefaultUnixSocketMode os.FileMode = 0600
+)
+
+// Option configures Forwarder.
+type Option func(f *Forwarder)
+
+// ConnHandler forwards accepted connection to the stream of target peer service and returns result of the copy.
+type ConnHandler func(ctx context.Context, local manet.Conn, remote network.Stream, opts ...p2p.CopyOption) p2p.CopyResult
+
+// WithConnHandler makes forwarder forward connections with the handler instead of p2p.FullDuplexCopy, e.g. to handle
+// requests of the target service protocol. Handler is not used for datagram sessions.
+func WithConnHandler(h ConnHandler) Option {
+	return func(f *Forwarder) {
+		f.connHandler = h
+	}
+}
+
+// WithUDPIdleTimeout sets timeout after which UDP session without datagrams in any direction is closed.
+func WithUDPIdleTimeout(d time.Duration) Option {
+	return func(f *Forwarder) {
+		if d > 0 {
+			f.udpIdleTimeout = d
+		}
+	}
+}
+
+// WithIdleTimeout sets timeout after which stream session without bytes copied in any direction is closed, datagram
+// sessions are closed after UDP idle timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(f *Forwarder) {
+		f.idleTimeout = d
+	}
+}
+
+// WithMaxLifetime sets maximum lifetime of sessions, zero means unlimited.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(f *Forwarder) {
+		f.maxLifetime = d
+	}
+}
+
+// WithBufferSize sets size of pooled buffers used to copy stream sessions data, p2p.DefaultBufferSize is used if size
+// is not positive.
+func WithBufferSize(size int) Option {
+	return func(f *Forwarder) {
+		f.bufferSize = size
+	}
+}
+
+// WithUnixSocketMode sets permissions of unix domain socket file forwarder listens on.
+func WithUnixSocketMode(mode os.FileMode) Option {
+	return func(f *Forwarder) {
+		if mode != 0 {
+			f.unixSocketMode = mode
+		}
+	}
+}
+
+// WithAccessLog makes forwarder write access log record for every session.
+func WithAccessLog(l *accesslog.Logger) Option {
+	return func(f *Forwarder) {
+		f.accessLog = l
+	}
+}
+
+// WithRateLimiter makes forwarder limit bandwidth of sessions with the limiter.
+func WithRateLimiter(l *ratelimit.Limiter) Option {
+	return func(f *Forwarder) {
+		f.rateLimiter = l
+	}
+}
+
+// WithSessionLimits caps number of concurrent sessions of the forwarder, per peer limit is not applied because clients
+// of the forwarder are local.
+func WithSessionLimits(limits connlimit.Limits) Option {
+	return func(f *Forwarder) {
+		f.sessionLimits = limits
+	}
+}
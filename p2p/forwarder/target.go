@@ -0,0 +1,126 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/discovery"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Target is a target peer connections are forwarded to.
+type Target interface {
+	// Connect ensures host is connected to the target peer and returns its ID.
+	Connect(ctx context.Context, h host.Host) (peer.ID, error)
+	String() string
+}
+
+// PeerTarget returns target peer specified by p2p address.
+func PeerTarget(targetAddr multiaddr.Multiaddr) (Target, error) {
+	targetPeerAddr, err := peer.AddrInfoFromP2pAddr(targetAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &peerTarget{addr: targetAddr, peerAddr: *targetPeerAddr}, nil
+}
+
+type peerTarget struct {
+	addr     multiaddr.Multiaddr
+	peerAddr peer.AddrInfo
+}
+
+func (t *peerTarget) Connect(ctx context.Context, h host.Host) (peer.ID, error) {
+	if err := p2p.EnsureConnectedToPeer(ctx, h, t.peerAddr); err != nil {
+		return "", err
+	}
+	return t.peerAddr.ID, nil
+}
+
+func (t *peerTarget) String() string { return t.addr.String() }
+
+// RendezvousTarget returns target peer advertised under the rendezvous name. The first reachable peer found is used
+// until connection to it is lost.
+func RendezvousTarget(d discovery.Discoverer, rendezvous string) Target {
+	return &rendezvousTarget{d: d, rendezvous: rendezvous}
+}
+
+type rendezvousTarget struct {
+	d          discovery.Discoverer
+	rendezvous string
+
+	mu      sync.Mutex
+	peerID  peer.ID   // last connected peer
+	pending *findCall // peer lookup in progress, shared by concurrent sessions
+}
+
+// findCall is a single lookup of the rendezvous peer, done is closed when peerID and err are set.
+type findCall struct {
+	done   chan struct{}
+	peerID peer.ID
+	err    error
+}
+
+func (t *rendezvousTarget) Connect(ctx context.Context, h host.Host) (peer.ID, error) {
+	t.mu.Lock()
+	if id := t.peerID; id != "" && h.Network().Connectedness(id) == network.Connected {
+		t.mu.Unlock()
+		return id, nil
+	}
+	if c := t.pending; c != nil {
+		t.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.peerID, c.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	c := &findCall{done: make(chan struct{})}
+	t.pending = c
+	t.mu.Unlock()
+
+	c.peerID, c.err = t.find(ctx, h)
+
+	t.mu.Lock()
+	t.pending = nil
+	if c.err == nil {
+		t.peerID = c.peerID
+	}
+	t.mu.Unlock()
+	close(c.done)
+
+	return c.peerID, c.err
+}
+
+// find connects to the first reachable peer advertised under the rendezvous name.
+func (t *rendezvousTarget) find(ctx context.Context, h host.Host) (peer.ID, error) {
+	peers, err := t.d.FindPeers(ctx, t.rendezvous)
+	if err != nil {
+		return "", err
+	}
+
+	for pi := range peers {
+		if pi.ID == h.ID() {
+			continue
+		}
+
+		if err := p2p.EnsureConnectedToPeer(ctx, h, pi); err != nil {
+			continue
+		}
+
+		logger.Infof("rendezvous %q resolved to peer %v", t.rendezvous, pi.ID)
+		return pi.ID, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no reachable peers found for rendezvous %q", t.rendezvous)
+}
+
+func (t *rendezvousTarget) String() string { return "rendezvous " + t.rendezvous }
@@ -0,0 +1,92 @@
+package forwarder
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/discovery"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+// blockingDiscoverer returns the peer when release is closed and counts lookups.
+type blockingDiscoverer struct {
+	pi      peer.AddrInfo
+	release chan struct{}
+	calls   int32
+}
+
+func (d *blockingDiscoverer) FindPeers(ctx context.Context, _ string, _ ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	atomic.AddInt32(&d.calls, 1)
+
+	ch := make(chan peer.AddrInfo, 1)
+	go func() {
+		defer close(ch)
+		select {
+		case <-d.release:
+			ch <- d.pi
+		case <-ctx.Done():
+		}
+	}()
+	return ch, nil
+}
+
+func TestRendezvousTargetConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshLinked(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	d := &blockingDiscoverer{
+		pi:      peer.AddrInfo{ID: hosts[1].ID(), Addrs: hosts[1].Addrs()},
+		release: make(chan struct{}),
+	}
+	target := RendezvousTarget(d, "test")
+
+	const sessions = 8
+	var wg sync.WaitGroup
+	ids := make([]peer.ID, sessions)
+	errs := make([]error, sessions)
+	for i := 0; i < sessions; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[i], errs[i] = target.Connect(ctx, hosts[0])
+		}()
+	}
+
+	// lookup in progress must not block sessions with expired context
+	time.Sleep(50 * time.Millisecond)
+	expired, expiredCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer expiredCancel()
+	if _, err := target.Connect(expired, hosts[0]); err != context.DeadlineExceeded {
+		t.Errorf("Connect with expired context returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	close(d.release)
+	wg.Wait()
+
+	for i := range ids {
+		if errs[i] != nil || ids[i] != hosts[1].ID() {
+			t.Errorf("session %d: Connect returned %v, %v, expected %v", i, ids[i], errs[i], hosts[1].ID())
+		}
+	}
+	if calls := atomic.LoadInt32(&d.calls); calls != 1 {
+		t.Errorf("FindPeers called %d times, expected 1", calls)
+	}
+
+	// connected peer is reused without lookup
+	if id, err := target.Connect(ctx, hosts[0]); err != nil || id != hosts[1].ID() {
+		t.Errorf("Connect returned %v, %v, expected %v", id, err, hosts[1].ID())
+	}
+	if calls := atomic.LoadInt32(&d.calls); calls != 1 {
+		t.Errorf("FindPeers called %d times after reconnect, expected 1", calls)
+	}
+}
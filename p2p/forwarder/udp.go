@@ -0,0 +1,233 @@
+package forwarder
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/metrics"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+	tec "github.com/jbenet/go-temp-err-catcher"
+)
+
+// udpSessionQueueSize is the number of datagrams queued for sending to target peer, datagrams that don't fit into the
+// queue are dropped.
+const udpSessionQueueSize = 64
+
+// udpSession forwards datagrams received from single source address to target peer.
+type udpSession struct {
+	ctx          context.Context
+	ctxCancel    func()
+	closeOnce    sync.Once
+	closeReason  p2p.CloseReason
+	srcAddr      net.Addr
+	outCh        chan []byte
+	lastActivity int64 // unix time in nanoseconds, accessed atomically
+}
+
+// close closes the session, only the first close reason is kept.
+func (s *udpSession) close(reason p2p.CloseReason) {
+	s.closeOnce.Do(func() {
+		s.closeReason = reason
+		s.ctxCancel()
+	})
+}
+
+func (s *udpSession) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+func (s *udpSession) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastActivity)))
+}
+
+func (s *udpSession) send(datagram []byte) {
+	select {
+	case s.outCh <- datagram:
+		s.touch()
+	default:
+		logger.Debugf("udp session %v queue is full, datagram dropped", s.srcAddr)
+	}
+}
+
+// udpSessions is a set of UDP sessions by source address.
+type udpSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+}
+
+func (f *Forwarder) serveDatagramsAsync() {
+	checkInterval := f.udpIdleTimeout / 2
+	if checkInterval < time.Second {
+		checkInterval = time.Second
+	}
+
+	async.Run(&f.wg, f.serveDatagrams)
+	async.RunPeriodically(&f.wg, f.ctx, checkInterval, func(ctx context.Context) error {
+		f.closeIdleUDPSessions()
+		return nil
+	})
+}
+
+func (f *Forwarder) serveDatagrams() {
+	defer logger.Info("stopped serving datagrams...")
+
+	pc := f.packetConn.Connection()
+	buf := make([]byte, p2p.MaxDatagramSize)
+	for {
+		n, srcAddr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if tec.ErrIsTemporary(err) {
+				continue
+			}
+			return
+		}
+
+		datagram := make([]byte, n)
+		copy(datagram, buf[:n])
+		f.udpSession(srcAddr).send(datagram)
+	}
+}
+
+// udpSession returns existing UDP session for the source address or starts new one.
+func (f *Forwarder) udpSession(srcAddr net.Addr) *udpSession {
+	f.udpSessions.mu.Lock()
+	defer f.udpSessions.mu.Unlock()
+
+	key := srcAddr.String()
+	if s, ok := f.udpSessions.sessions[key]; ok {
+		return s
+	}
+
+	ctx, ctxCancel := context.WithCancel(f.ctx)
+	s := &udpSession{
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+		srcAddr:   srcAddr,
+		outCh:     make(chan []byte, udpSessionQueueSize),
+	}
+	s.touch()
+	f.udpSessions.sessions[key] = s
+
+	async.Run(&f.wg, func() { f.handleUDPSession(s) })
+
+	return s
+}
+
+func (f *Forwarder) removeUDPSession(s *udpSession) {
+	f.udpSessions.mu.Lock()
+	defer f.udpSessions.mu.Unlock()
+
+	key := s.srcAddr.String()
+	if f.udpSessions.sessions[key] == s {
+		delete(f.udpSessions.sessions, key)
+	}
+}
+
+func (f *Forwarder) closeIdleUDPSessions() {
+	f.udpSessions.mu.Lock()
+	defer f.udpSessions.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range f.udpSessions.sessions {
+		if s.idleFor(now) >= f.udpIdleTimeout {
+			logger.Debugf("closing idle udp session %v", s.srcAddr)
+			s.close(p2p.IdleTimeout)
+		}
+	}
+}
+
+func (f *Forwarder) handleUDPSession(s *udpSession) {
+	defer f.removeUDPSession(s)
+	defer s.ctxCancel()
+
+	releaseSession, err := f.acquireSession(s.srcAddr)
+	if err != nil {
+		return
+	}
+	defer releaseSession()
+
+	remote, err := f.newStreamToTargetPeer()
+	if err != nil {
+		logger.Warningf("failed to create stream to target peer: %v", err)
+		return
+	}
+
+	remoteConn := remote.Conn()
+	defer f.addSession(remoteConn.RemotePeer(), s.srcAddr)()
+
+	logger.Debugf("forwarding datagrams %v to %v (%v)...", s.srcAddr, remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr())
+
+	upload, download, releaseRate := f.rateLimiter.Session(remoteConn.RemotePeer())
+	defer releaseRate()
+
+	start := time.Now()
+	countIn, countOut := metrics.ByteCounters(f.service)
+	var res p2p.CopyResult
+
+	var wg sync.WaitGroup
+	async.Run(&wg, func() {
+		defer s.close(p2p.RemoteClosed)
+
+		pc := f.packetConn.Connection()
+		buf := make([]byte, p2p.MaxDatagramSize)
+		for {
+			n, err := p2p.ReadDatagram(remote, buf)
+			if err != nil {
+				return
+			}
+			if err := ratelimit.WaitN(s.ctx, download, n); err != nil {
+				return
+			}
+			if _, err := pc.WriteTo(buf[:n], s.srcAddr); err != nil {
+				return
+			}
+			res.In += int64(n)
+			countIn(int64(n))
+			s.touch()
+		}
+	})
+
+	var lifetime <-chan time.Time
+	if f.maxLifetime > 0 {
+		t := time.NewTimer(f.maxLifetime)
+		defer t.Stop()
+		lifetime = t.C
+	}
+
+	func() {
+		for {
+			select {
+			case datagram := <-s.outCh:
+				if err := ratelimit.WaitN(s.ctx, upload, len(datagram)); err != nil {
+					s.close(p2p.Shutdown)
+					return
+				}
+				if err := p2p.WriteDatagram(remote, datagram); err != nil {
+					s.close(p2p.RemoteClosed)
+					return
+				}
+				res.Out += int64(len(datagram))
+				countOut(int64(len(datagram)))
+			case <-lifetime:
+				s.close(p2p.MaxLifetime)
+				return
+			case <-s.ctx.Done():
+				// session context is also done when forwarder is closing
+				s.close(p2p.Shutdown)
+				return
+			}
+		}
+	}()
+
+	_ = remote.Reset()
+	wg.Wait()
+
+	res.CloseReason = s.closeReason
+	logger.Debugf("stopped forwarding datagrams %v to %v (%v): %v.", s.srcAddr, remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr(), res.CloseReason)
+	f.logSession(start, remoteConn, s.srcAddr, res)
+}
@@ -0,0 +1,161 @@
+package forwarder
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const testProtocolID = "/test/udp-echo"
+
+// newTestUDPForwarder starts UDP forwarder to the target peer that echoes datagrams back and returns the forwarder and
+// the counter of streams opened to the target peer.
+func newTestUDPForwarder(t *testing.T, ctx context.Context, idleTimeout time.Duration) (*Forwarder, *int32) {
+	t.Helper()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	var streams int32
+	hosts[1].SetStreamHandler(p2p.DatagramProtocolID(testProtocolID), func(s network.Stream) {
+		defer func() { _ = s.Reset() }()
+		atomic.AddInt32(&streams, 1)
+
+		buf := make([]byte, p2p.MaxDatagramSize)
+		for {
+			n, err := p2p.ReadDatagram(s, buf)
+			if err != nil {
+				return
+			}
+			if err := p2p.WriteDatagram(s, buf[:n]); err != nil {
+				return
+			}
+		}
+	})
+
+	target, err := PeerTarget(hosts[1].Addrs()[0].Encapsulate(multiaddr.StringCast("/ipfs/" + hosts[1].ID().Pretty())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(ctx, hosts[0], multiaddr.StringCast("/ip4/127.0.0.1/udp/0"), target, testProtocolID, WithUDPIdleTimeout(idleTimeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, &streams
+}
+
+// dialUDP returns UDP client connected to the forwarder.
+func dialUDP(t *testing.T, f *Forwarder) net.Conn {
+	t.Helper()
+
+	c, err := net.Dial("udp", f.packetConn.Connection().LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// assertEcho sends the datagram and asserts that it is echoed back.
+func assertEcho(t *testing.T, c net.Conn, datagram string) {
+	t.Helper()
+
+	if _, err := c.Write([]byte(datagram)); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, p2p.MaxDatagramSize)
+	n, err := c.Read(buf)
+	if err != nil || string(buf[:n]) != datagram {
+		t.Fatalf("echo = %q, %v, expected %q", buf[:n], err, datagram)
+	}
+}
+
+func (f *Forwarder) udpSessionCount() int {
+	f.udpSessions.mu.Lock()
+	defer f.udpSessions.mu.Unlock()
+	return len(f.udpSessions.sessions)
+}
+
+// waitUDPSessionCount waits until the forwarder has expected number of UDP sessions.
+func waitUDPSessionCount(t *testing.T, f *Forwarder, expected int, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for f.udpSessionCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("UDP sessions = %v, expected %v", f.udpSessionCount(), expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUDPSessions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, streams := newTestUDPForwarder(t, ctx, 300*time.Millisecond)
+	defer func() { _ = f.Close() }()
+
+	c1 := dialUDP(t, f)
+	defer func() { _ = c1.Close() }()
+
+	assertEcho(t, c1, "first")
+	assertEcho(t, c1, "second")
+	if n := f.udpSessionCount(); n != 1 {
+		t.Errorf("UDP sessions after datagrams from one source = %v, expected 1", n)
+	}
+	if n := atomic.LoadInt32(streams); n != 1 {
+		t.Errorf("streams after datagrams from one source = %v, expected 1", n)
+	}
+
+	c2 := dialUDP(t, f)
+	defer func() { _ = c2.Close() }()
+
+	assertEcho(t, c2, "other source")
+	if n := f.udpSessionCount(); n != 2 {
+		t.Errorf("UDP sessions after datagrams from two sources = %v, expected 2", n)
+	}
+	if n := atomic.LoadInt32(streams); n != 2 {
+		t.Errorf("streams after datagrams from two sources = %v, expected 2", n)
+	}
+
+	// idle sessions are checked at least every second
+	waitUDPSessionCount(t, f, 0, 3*time.Second)
+
+	// datagram after idle session is closed starts new session
+	assertEcho(t, c1, "third")
+	if n := f.udpSessionCount(); n != 1 {
+		t.Errorf("UDP sessions after idle timeout = %v, expected 1", n)
+	}
+	if n := atomic.LoadInt32(streams); n != 3 {
+		t.Errorf("streams after idle timeout = %v, expected 3", n)
+	}
+}
+
+func TestUDPSessionsClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, _ := newTestUDPForwarder(t, ctx, time.Minute)
+
+	c := dialUDP(t, f)
+	defer func() { _ = c.Close() }()
+
+	assertEcho(t, c, "ping")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.udpSessionCount(); n != 0 {
+		t.Errorf("UDP sessions after forwarder is closed = %v, expected 0", n)
+	}
+}
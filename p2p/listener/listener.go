@@ -6,11 +6,16 @@ import (
 	"time"
 
 	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/metrics"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/session"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
-	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr-net"
 )
@@ -25,32 +30,56 @@ type Listener struct {
 	ctxCancel func()
 	wg        sync.WaitGroup
 
-	h              host.Host
-	targetAddr     multiaddr.Multiaddr
-	clientPeerAddr peer.AddrInfo
+	h           host.Host
+	services    []Service
+	clientPeers *acl.Peers
+	sessions    session.Sessions
+	accessLog   *accesslog.Logger
+	rateLimiter *ratelimit.Limiter
+
+	sessionLimits connlimit.Limits
+	idleTimeout   time.Duration
+	maxLifetime   time.Duration
+	bufferSize    int
 }
 
-func New(ctx context.Context, h host.Host, targetAddr multiaddr.Multiaddr, clientAddr multiaddr.Multiaddr) (*Listener, error) {
-	clientPeerAddr, err := peer.AddrInfoFromP2pAddr(clientAddr)
-	if err != nil {
+func New(ctx context.Context, h host.Host, services []Service, clientPeers *acl.Peers, opts ...Option) (*Listener, error) {
+	if err := validateServices(services); err != nil {
 		return nil, err
 	}
 
 	listenerCtx, ctxCancel := context.WithCancel(ctx)
 	listener := &Listener{
-		ctx:            listenerCtx,
-		ctxCancel:      ctxCancel,
-		h:              h,
-		targetAddr:     targetAddr,
-		clientPeerAddr: *clientPeerAddr,
+		ctx:         listenerCtx,
+		ctxCancel:   ctxCancel,
+		h:           h,
+		services:    append([]Service(nil), services...),
+		clientPeers: clientPeers,
+	}
+	for _, opt := range opts {
+		opt(listener)
 	}
 
-	h.SetStreamHandler(ID, listener.handleStream)
-	listener.keepClientConnectionAsync()
+	for i := range listener.services {
+		service := &listener.services[i]
+		limiter := connlimit.New(listener.sessionLimits)
+		h.SetStreamHandler(service.ProtocolID(), func(remote network.Stream) { listener.handleStream(service, limiter, remote) })
+	}
+	listener.keepClientConnectionsAsync()
 
 	return listener, nil
 }
 
+// Services returns services exposed by listener.
+func (l *Listener) Services() []Service {
+	return append([]Service(nil), l.services...)
+}
+
+// Sessions returns active forwarding sessions.
+func (l *Listener) Sessions() []session.Info {
+	return l.sessions.List()
+}
+
 func (l *Listener) Close() (err error) {
 	l.closeOnce.Do(func() {
 		err = l.close()
@@ -62,7 +91,9 @@ func (l *Listener) close() error {
 	logger.Info("closing listener...")
 	defer logger.Info("listener closed.")
 
-	l.h.RemoveStreamHandler(ID)
+	for i := range l.services {
+		l.h.RemoveStreamHandler(l.services[i].ProtocolID())
+	}
 
 	l.ctxCancel()
 	l.wg.Wait()
@@ -70,23 +101,82 @@ func (l *Listener) close() error {
 	return nil
 }
 
-func (l *Listener) handleStream(remote network.Stream) {
+func (l *Listener) handleStream(service *Service, limiter *connlimit.Limiter, remote network.Stream) {
+	serviceName := "listen " + service.String()
 	remoteConn := remote.Conn()
-	if remotePeerID := remoteConn.RemotePeer(); l.clientPeerAddr.ID != remotePeerID {
+	clientPeer, ok := l.clientPeers.Get(remoteConn.RemotePeer())
+	if !ok {
 		logger.Warningf("unauthorized peer rejected: %v (%v)", remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr())
+		metrics.StreamOpenFailed(serviceName, metrics.Unauthorized)
+		_ = remote.Reset()
+		return
+	}
+
+	if !clientPeer.CanAccess(service.targets()...) {
+		logger.Warningf("peer %v (%v) is not allowed to access %v", &clientPeer, remoteConn.RemoteMultiaddr(), service)
+		metrics.StreamOpenFailed(serviceName, metrics.Forbidden)
 		_ = remote.Reset()
 		return
 	}
 
-	local, err := l.dialWithTimeout(l.targetAddr, 30*time.Second)
+	releaseSession, err := limiter.Acquire(l.ctx, clientPeer.ID)
 	if err != nil {
+		logger.Warningf("peer %v (%v) stream to %v rejected: %v", &clientPeer, remoteConn.RemoteMultiaddr(), service, err)
+		metrics.StreamOpenFailed(serviceName, metrics.LimitExceeded)
 		_ = remote.Reset()
 		return
 	}
+	defer releaseSession()
+
+	logger.Infof("peer %v (%v) opened stream to %v", &clientPeer, remoteConn.RemoteMultiaddr(), service)
+
+	dialStart := time.Now()
+	local, err := l.dialWithTimeout(service.TargetAddr, 30*time.Second)
+	metrics.TargetDialed(serviceName, time.Since(dialStart))
+	if err != nil {
+		logger.Warningf("failed to dial target %v for peer %v: %v", service, &clientPeer, err)
+		metrics.StreamOpenFailed(serviceName, metrics.TargetDialFailed)
+		_ = remote.Reset()
+		return
+	}
+
+	defer metrics.SessionStarted(serviceName)()
+	defer l.sessions.Add(session.Info{
+		Service:   serviceName,
+		Peer:      clientPeer.ID,
+		LocalAddr: local.RemoteAddr().String(),
+	})()
+
+	logger.Debugf("forwarding %v (%v) to %v...", &clientPeer, remoteConn.RemoteMultiaddr(), local.RemoteAddr())
+	upload, download, releaseRate := l.rateLimiter.Session(clientPeer.ID)
+	defer releaseRate()
+
+	datagram := p2p.IsDatagramAddr(service.TargetAddr)
+	idleTimeout := l.idleTimeout
+	if datagram && idleTimeout <= 0 {
+		idleTimeout = DefaultUDPIdleTimeout
+	}
+
+	start := time.Now()
+	copyOpts := []p2p.CopyOption{
+		p2p.WithByteCounters(metrics.ByteCounters(serviceName)),
+		p2p.WithRateLimiters(download, upload),
+		p2p.WithIdleTimeout(idleTimeout),
+		p2p.WithMaxLifetime(l.maxLifetime),
+		p2p.WithBufferSize(l.bufferSize),
+	}
+	var res p2p.CopyResult
+	if datagram {
+		res = p2p.DatagramDuplexCopy(l.ctx, local, remote, copyOpts...)
+	} else {
+		res = p2p.FullDuplexCopy(l.ctx, local, remote, copyOpts...)
+	}
+	logger.Debugf("stopped forwarding %v (%v) to %v: %v.", &clientPeer, remoteConn.RemoteMultiaddr(), local.RemoteAddr(), res.CloseReason)
 
-	logger.Debugf("forwarding %v (%v) to %v...", remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr(), local.RemoteAddr())
-	defer logger.Debugf("stopped forwarding %v (%v) to %v.", remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr(), local.RemoteAddr())
-	p2p.FullDuplexCopy(l.ctx, local, remote)
+	r := accesslog.SessionRecord(serviceName, start, remoteConn, res)
+	r.Target = service.TargetAddr.String()
+	r.Protocol = string(service.ProtocolID())
+	l.accessLog.Log(r)
 }
 
 func (l *Listener) dialWithTimeout(target multiaddr.Multiaddr, timeout time.Duration) (manet.Conn, error) {
@@ -96,11 +186,9 @@ func (l *Listener) dialWithTimeout(target multiaddr.Multiaddr, timeout time.Dura
 	return (&manet.Dialer{}).DialContext(ctx, target)
 }
 
-func (l *Listener) keepClientConnectionAsync() {
+func (l *Listener) keepClientConnectionsAsync() {
 	async.RunPeriodically(&l.wg, l.ctx, 5*time.Second, func(ctx context.Context) error {
-		if err := p2p.EnsureConnectedToPeerWithTimeout(ctx, l.h, l.clientPeerAddr, time.Second*30); err != nil {
-			logger.Debugf("failed to connect to client peer: %v", err)
-		}
+		p2p.EnsureConnectedToPeersWithTimeout(ctx, l.h, l.clientPeers.AddrInfos(), time.Second*30)
 		return nil
 	})
 }
@@ -0,0 +1,61 @@
+package listener
+
+import (
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+)
+
+// DefaultUDPIdleTimeout is the idle timeout of datagram sessions used if idle timeout is not set, because datagram
+// target never closes session itself.
+const DefaultUDPIdleTimeout = time.Minute
+
+// Option configures Listener.
+type Option func(l *Listener)
+
+// WithAccessLog makes listener write access log record for every session.
+func WithAccessLog(al *accesslog.Logger) Option {
+	return func(l *Listener) {
+		l.accessLog = al
+	}
+}
+
+// WithRateLimiter makes listener limit bandwidth of sessions with the limiter.
+func WithRateLimiter(rl *ratelimit.Limiter) Option {
+	return func(l *Listener) {
+		l.rateLimiter = rl
+	}
+}
+
+// WithSessionLimits caps number of concurrent sessions of every service and sessions of the same client peer with
+// every service.
+func WithSessionLimits(limits connlimit.Limits) Option {
+	return func(l *Listener) {
+		l.sessionLimits = limits
+	}
+}
+
+// WithIdleTimeout sets timeout after which session without bytes copied in any direction is closed, zero means no
+// timeout for stream sessions and DefaultUDPIdleTimeout for datagram ones.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(l *Listener) {
+		l.idleTimeout = d
+	}
+}
+
+// WithMaxLifetime sets maximum lifetime of sessions, zero means unlimited.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(l *Listener) {
+		l.maxLifetime = d
+	}
+}
+
+// WithBufferSize sets size of pooled buffers used to copy sessions data, p2p.DefaultBufferSize is used if size is not
+// positive.
+func WithBufferSize(size int) Option {
+	return func(l *Listener) {
+		l.bufferSize = size
+	}
+}
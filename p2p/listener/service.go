@@ -0,0 +1,87 @@
+package listener
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Service is a named target service exposed by listener.
+type Service struct {
+	Name       string              // service name, empty name means default service
+	TargetAddr multiaddr.Multiaddr // target address to forward connections to
+}
+
+// String returns service name and target address.
+func (s *Service) String() string {
+	if s.Name == "" {
+		return s.TargetAddr.String()
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, s.TargetAddr)
+}
+
+// ProtocolID returns protocol ID the service is registered with, services with datagram target address are registered
+// with datagram protocol ID (see p2p.DatagramProtocolID).
+func (s *Service) ProtocolID() protocol.ID {
+	if p2p.IsDatagramAddr(s.TargetAddr) {
+		return p2p.DatagramProtocolID(ServiceProtocolID(s.Name))
+	}
+	return ServiceProtocolID(s.Name)
+}
+
+// targets returns all target names authorized peers can be allowed to access the service by: service name (if any)
+// and target address.
+func (s *Service) targets() []string {
+	if s.Name == "" {
+		return []string{s.TargetAddr.String()}
+	}
+	return []string{s.Name, s.TargetAddr.String()}
+}
+
+// ServiceProtocolID returns protocol ID of the service with the given name, empty name means default service.
+func ServiceProtocolID(name string) protocol.ID {
+	if name == "" {
+		return ID
+	}
+	return protocol.ID(ID + "/" + name)
+}
+
+// ValidateServiceName checks that service name can be used as part of protocol ID.
+func ValidateServiceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty service name")
+	}
+	if strings.ContainsAny(name, "/ \t\r\n") {
+		return fmt.Errorf("invalid service name '%v': must not contain slashes or whitespaces", name)
+	}
+	return nil
+}
+
+func validateServices(services []Service) error {
+	if len(services) == 0 {
+		return fmt.Errorf("no services to listen")
+	}
+
+	names := make(map[string]struct{}, len(services))
+	for _, s := range services {
+		if s.Name != "" {
+			if err := ValidateServiceName(s.Name); err != nil {
+				return err
+			}
+		}
+		if p2p.IsUnixAddr(s.TargetAddr) {
+			if err := p2p.CheckUnixSocket(s.TargetAddr); err != nil {
+				return err
+			}
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("duplicate service '%v'", s.Name)
+		}
+		names[s.Name] = struct{}{}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "p2p_forwarding"
+
+// FailureReason is a reason of the stream open failure.
+type FailureReason string
+
+// Stream open failure reasons.
+const (
+	ConnectTimeout      FailureReason = "connect_timeout"      // connecting to target peer timed out
+	ConnectFailed       FailureReason = "connect_failed"       // connecting to target peer failed
+	ProtocolNegotiation FailureReason = "protocol_negotiation" // target peer doesn't support or rejected protocol
+	Unauthorized        FailureReason = "unauthorized"         // remote peer is not authorized
+	Forbidden           FailureReason = "forbidden"            // remote peer is not allowed to access target
+	TargetDialFailed    FailureReason = "target_dial_failed"   // dialing target address failed
+	LimitExceeded       FailureReason = "limit_exceeded"       // maximum number of concurrent sessions reached
+)
+
+var (
+	bytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_total",
+		Help:      "Bytes forwarded by service, direction is 'in' for bytes received from p2p stream and 'out' for bytes sent to it.",
+	}, []string{"service", "direction"})
+
+	sessionsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_active",
+		Help:      "Active forwarding sessions by service.",
+	}, []string{"service"})
+
+	sessionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_total",
+		Help:      "Forwarding sessions started by service.",
+	}, []string{"service"})
+
+	streamOpenFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_open_failures_total",
+		Help:      "Failures to open forwarding session by service and reason.",
+	}, []string{"service", "reason"})
+
+	targetDialDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "target_dial_duration_seconds",
+		Help:      "Latency of dialing target address by listener service.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"service"})
+)
+
+func init() {
+	prometheus.MustRegister(bytesTotal, sessionsActive, sessionsTotal, streamOpenFailures, targetDialDuration)
+}
+
+// SessionStarted accounts started session of the service and returns function that must be called when session is
+// finished.
+func SessionStarted(service string) (finished func()) {
+	sessionsTotal.WithLabelValues(service).Inc()
+	active := sessionsActive.WithLabelValues(service)
+	active.Inc()
+	return active.Dec
+}
+
+// ByteCounters returns functions that account bytes received from p2p stream (in) and sent to it (out) by the service.
+func ByteCounters(service string) (in, out func(n int64)) {
+	inCounter := bytesTotal.WithLabelValues(service, "in")
+	outCounter := bytesTotal.WithLabelValues(service, "out")
+	return func(n int64) { inCounter.Add(float64(n)) }, func(n int64) { outCounter.Add(float64(n)) }
+}
+
+// StreamOpenFailed accounts failure to open forwarding session of the service.
+func StreamOpenFailed(service string, reason FailureReason) {
+	streamOpenFailures.WithLabelValues(service, string(reason)).Inc()
+}
+
+// ConnectFailureReason returns failure reason of connecting to target peer with the context.
+func ConnectFailureReason(ctx context.Context) FailureReason {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ConnectTimeout
+	}
+	return ConnectFailed
+}
+
+// TargetDialed accounts latency of dialing target address by the service.
+func TargetDialed(service string, d time.Duration) {
+	targetDialDuration.WithLabelValues(service).Observe(d.Seconds())
+}
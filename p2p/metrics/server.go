@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var logger = logging.Logger("metrics")
+
+// Server serves Prometheus metrics over HTTP on /metrics path.
+type Server struct {
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	server    *http.Server
+	collector prometheus.Collector
+}
+
+// New starts metrics server on the address and registers metrics of the node.
+func New(node *p2p.Node, addr multiaddr.Multiaddr) (*Server, error) {
+	collector := newNodeCollector(node)
+	if err := prometheus.Register(collector); err != nil {
+		return nil, err
+	}
+
+	lst, err := manet.Listen(addr)
+	if err != nil {
+		prometheus.Unregister(collector)
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	s := &Server{
+		server:    &http.Server{Handler: mux},
+		collector: collector,
+	}
+
+	async.Run(&s.wg, func() {
+		if err := s.server.Serve(manet.NetListener(lst)); err != nil && err != http.ErrServerClosed {
+			logger.Warningf("metrics server error: %v", err)
+		}
+	})
+
+	return s, nil
+}
+
+func (s *Server) Close() (err error) {
+	s.closeOnce.Do(func() {
+		err = s.close()
+	})
+	return
+}
+
+func (s *Server) close() error {
+	logger.Info("closing metrics server...")
+	defer logger.Info("metrics server closed.")
+
+	err := s.server.Shutdown(context.Background())
+	s.wg.Wait()
+	prometheus.Unregister(s.collector)
+
+	return err
+}
+
+// nodeCollector collects connectivity metrics of the node.
+type nodeCollector struct {
+	node *p2p.Node
+
+	connectedPeers  *prometheus.Desc
+	relayAddrs      *prometheus.Desc
+	relayedConns    *prometheus.Desc
+	relaysConnected *prometheus.Desc
+}
+
+func newNodeCollector(node *p2p.Node) *nodeCollector {
+	return &nodeCollector{
+		node:            node,
+		connectedPeers:  prometheus.NewDesc(namespace+"_connected_peers", "Number of connected peers.", nil, nil),
+		relayAddrs:      prometheus.NewDesc(namespace+"_relay_addresses", "Number of announced circuit relay addresses.", nil, nil),
+		relayedConns:    prometheus.NewDesc(namespace+"_relayed_connections", "Number of connections through circuit relays.", nil, nil),
+		relaysConnected: prometheus.NewDesc(namespace+"_relays_connected", "Number of connected relays from --relay option.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector interface
+func (c *nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connectedPeers
+	ch <- c.relayAddrs
+	ch <- c.relayedConns
+	ch <- c.relaysConnected
+}
+
+// Collect implements prometheus.Collector interface
+func (c *nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	status := c.node.RelayStatus()
+	ch <- prometheus.MustNewConstMetric(c.connectedPeers, prometheus.GaugeValue, float64(len(c.node.Network().Peers())))
+	ch <- prometheus.MustNewConstMetric(c.relayAddrs, prometheus.GaugeValue, float64(status.RelayAddrs))
+	ch <- prometheus.MustNewConstMetric(c.relayedConns, prometheus.GaugeValue, float64(status.RelayedConns))
+	ch <- prometheus.MustNewConstMetric(c.relaysConnected, prometheus.GaugeValue, float64(status.RelaysConnected))
+}
@@ -2,6 +2,7 @@ package p2p
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -13,7 +14,9 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/pnet"
 	"github.com/libp2p/go-libp2p-core/routing"
+	discovery "github.com/libp2p/go-libp2p-discovery"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	dhtopts "github.com/libp2p/go-libp2p-kad-dht/opts"
 )
@@ -24,29 +27,64 @@ func init() {
 	crypto.MinRsaKeyBits = 512 // bootstrap workaround: failed to negotiate security protocol: rsa keys must be >= 2048 bits to be useful
 }
 
+// NodeConfig contains node settings that are not covered by libp2p options.
+type NodeConfig struct {
+	// BootstrapPeers are used in addition to the default public bootstrap peers.
+	BootstrapPeers []peer.AddrInfo
+	// NoPublicBootstrap disables default public bootstrap peers, so node bootstraps only against BootstrapPeers.
+	NoPublicBootstrap bool
+	// DHTServer runs DHT in server mode, so node can serve DHT requests and be a bootstrap peer for other nodes.
+	DHTServer bool
+	// PrivateNetwork protects connections with pre-shared key, so node can connect only to the nodes with the same key.
+	// Public bootstrap peers are not used in private network.
+	PrivateNetwork pnet.Protector
+	// NoNATPortMap disables opening of the node port in the firewall using UPnP/NAT-PMP.
+	NoNATPortMap bool
+	// NoRelay disables circuit relay transport, node neither dials through relays nor accepts relayed connections.
+	NoRelay bool
+	// NoAutoRelay disables looking for public relays and announcing relay addresses when node is behind NAT.
+	NoAutoRelay bool
+	// Relays are relay peers node keeps connections to.
+	Relays []peer.AddrInfo
+	// RelayOnly makes node announce only circuit addresses through Relays, so node is reachable only via relays.
+	RelayOnly bool
+	// RelayHop makes node act as circuit relay for other peers.
+	RelayHop bool
+	// RelayHopLimit limits number of relayed connections, zero means default limit.
+	RelayHopLimit int
+}
+
 type Node struct {
 	closeOnce sync.Once
 	ctx       context.Context
 	ctxCancel func()
 	wg        sync.WaitGroup
+	cfg       NodeConfig
+	discovery *discovery.RoutingDiscovery
 
 	host.Host
 	*dht.IpfsDHT
 }
 
-func NewNode(ctx context.Context, opts ...libp2p.Option) (node *Node, err error) {
+func NewNode(ctx context.Context, cfg NodeConfig, opts ...libp2p.Option) (node *Node, err error) {
 	nodeCtx, ctxCancel := context.WithCancel(ctx)
 	n := &Node{
 		ctx:       nodeCtx,
 		ctxCancel: ctxCancel,
+		cfg:       cfg,
 	}
 
-	opts = append(opts,
-		libp2p.NATPortMap(),
-		libp2p.EnableRelay(),
-		libp2p.EnableAutoRelay(),
-		libp2p.Routing(n.routingFactory(nodeCtx, dhtopts.Client(true))),
-	)
+	if cfg.PrivateNetwork != nil {
+		opts = append(opts, libp2p.PrivateNetwork(cfg.PrivateNetwork))
+	}
+
+	relayOpts, err := n.relayOptions()
+	if err != nil {
+		ctxCancel()
+		return nil, err
+	}
+	opts = append(opts, relayOpts...)
+	opts = append(opts, libp2p.Routing(n.routingFactory(nodeCtx, dhtopts.Client(!cfg.DHTServer))))
 
 	n.Host, err = libp2p.New(nodeCtx, opts...)
 	if err != nil {
@@ -62,16 +100,20 @@ func NewNode(ctx context.Context, opts ...libp2p.Option) (node *Node, err error)
 	if err := n.bootstrap(); err != nil {
 		return nil, err
 	}
+	n.keepRelayConnectionsAsync()
 
 	node = n
 	return
 }
 
 func (n *Node) bootstrap() error {
-	peerAddrInfos, err := defaultBootstrapPeerAddresses()
+	peerAddrInfos, err := n.bootstrapPeerAddresses()
 	if err != nil {
 		return err
 	}
+	if len(peerAddrInfos) == 0 {
+		logger.Warning("no bootstrap peers, node can be reached only by its direct addresses")
+	}
 
 	n.addBootstrapNodesAsPermanentToPeerstore(peerAddrInfos)
 	n.connectToBootstrapPeers(peerAddrInfos)
@@ -150,6 +192,7 @@ func (n *Node) routingFactory(ctx context.Context, opts ...dhtopts.Option) func(
 			return nil, err
 		}
 		n.IpfsDHT = dhtInst
+		n.discovery = discovery.NewRoutingDiscovery(dhtInst)
 		return dhtInst, nil
 	}
 }
@@ -170,6 +213,25 @@ func (n *Node) close() error {
 	return n.Host.Close()
 }
 
+func (n *Node) bootstrapPeerAddresses() ([]peer.AddrInfo, error) {
+	for _, pi := range n.cfg.BootstrapPeers {
+		if len(pi.Addrs) == 0 {
+			return nil, fmt.Errorf("bootstrap peer %v has no addresses", pi.ID)
+		}
+	}
+
+	if n.cfg.NoPublicBootstrap || n.cfg.PrivateNetwork != nil {
+		return n.cfg.BootstrapPeers, nil
+	}
+
+	pis, err := defaultBootstrapPeerAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(pis, n.cfg.BootstrapPeers...), nil
+}
+
 func defaultBootstrapPeerAddresses() ([]peer.AddrInfo, error) {
 	bootstrapPeers := dht.DefaultBootstrapPeers
 	pis := make([]peer.AddrInfo, 0, len(bootstrapPeers))
@@ -0,0 +1,93 @@
+package quic
+
+import (
+	"context"
+
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/mux"
+	"github.com/libp2p/go-libp2p-core/peer"
+	tpt "github.com/libp2p/go-libp2p-core/transport"
+	ma "github.com/multiformats/go-multiaddr"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// conn is QUIC connection, it is secured by TLS and multiplexes streams by itself, so it needs no upgrade.
+type conn struct {
+	qconn     quicgo.Connection
+	transport tpt.Transport
+
+	localPeer      peer.ID
+	privKey        ic.PrivKey
+	localMultiaddr ma.Multiaddr
+
+	remotePeerID    peer.ID
+	remotePubKey    ic.PubKey
+	remoteMultiaddr ma.Multiaddr
+}
+
+var _ tpt.CapableConn = (*conn)(nil)
+
+func (c *conn) Close() error {
+	return c.qconn.CloseWithError(0, "")
+}
+
+func (c *conn) IsClosed() bool {
+	return c.qconn.Context().Err() != nil
+}
+
+func (c *conn) OpenStream() (mux.MuxedStream, error) {
+	s, err := c.qconn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &stream{Stream: s}, nil
+}
+
+func (c *conn) AcceptStream() (mux.MuxedStream, error) {
+	s, err := c.qconn.AcceptStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &stream{Stream: s}, nil
+}
+
+func (c *conn) LocalPeer() peer.ID {
+	return c.localPeer
+}
+
+func (c *conn) LocalPrivateKey() ic.PrivKey {
+	return c.privKey
+}
+
+func (c *conn) RemotePeer() peer.ID {
+	return c.remotePeerID
+}
+
+func (c *conn) RemotePublicKey() ic.PubKey {
+	return c.remotePubKey
+}
+
+func (c *conn) LocalMultiaddr() ma.Multiaddr {
+	return c.localMultiaddr
+}
+
+func (c *conn) RemoteMultiaddr() ma.Multiaddr {
+	return c.remoteMultiaddr
+}
+
+func (c *conn) Transport() tpt.Transport {
+	return c.transport
+}
+
+// stream is QUIC stream, closing it closes only the write side like closing of libp2p muxed stream does.
+type stream struct {
+	quicgo.Stream
+}
+
+var _ mux.MuxedStream = (*stream)(nil)
+
+func (s *stream) Reset() error {
+	s.Stream.CancelRead(0)
+	s.Stream.CancelWrite(0)
+	return nil
+}
@@ -0,0 +1,127 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	tpt "github.com/libp2p/go-libp2p-core/transport"
+	p2ptls "github.com/libp2p/go-libp2p-tls"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+type listener struct {
+	pconn          net.PacketConn
+	qlistener      *quicgo.Listener
+	transport      *Transport
+	localMultiaddr ma.Multiaddr
+}
+
+var _ tpt.Listener = (*listener)(nil)
+
+func newListener(addr ma.Multiaddr, t *Transport) (*listener, error) {
+	network, host, err := manet.DialArgs(addr)
+	if err != nil {
+		return nil, err
+	}
+	laddr, err := net.ResolveUDPAddr(network, host)
+	if err != nil {
+		return nil, err
+	}
+	pconn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf := &tls.Config{
+		// incoming connection can't be associated with the config it is verified by, so remote public key is taken
+		// from the certificate again once connection is accepted
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			conf, _ := t.identity.ConfigForAny()
+			conf.NextProtos = []string{alpn}
+			// quic-go expects the ticket to be issued after handshake and panics if tickets are disabled, sessions are
+			// still never resumed: dialers keep no session cache
+			conf.SessionTicketsDisabled = false
+			return conf, nil
+		},
+	}
+	qlistener, err := quicgo.Listen(pconn, tlsConf, quicConfig)
+	if err != nil {
+		_ = pconn.Close()
+		return nil, err
+	}
+	localMultiaddr, err := toQuicMultiaddr(qlistener.Addr())
+	if err != nil {
+		_ = qlistener.Close()
+		_ = pconn.Close()
+		return nil, err
+	}
+
+	return &listener{
+		pconn:          pconn,
+		qlistener:      qlistener,
+		transport:      t,
+		localMultiaddr: localMultiaddr,
+	}, nil
+}
+
+// Accept waits for the next connection with verified peer identity.
+func (l *listener) Accept() (tpt.CapableConn, error) {
+	for {
+		qconn, err := l.qlistener.Accept(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		c, err := l.setupConn(qconn)
+		if err != nil {
+			_ = qconn.CloseWithError(0, err.Error())
+			continue
+		}
+		return c, nil
+	}
+}
+
+func (l *listener) setupConn(qconn quicgo.Connection) (*conn, error) {
+	remotePubKey, err := p2ptls.PubKeyFromCertChain(qconn.ConnectionState().TLS.PeerCertificates)
+	if err != nil {
+		return nil, err
+	}
+	remotePeerID, err := peer.IDFromPublicKey(remotePubKey)
+	if err != nil {
+		return nil, err
+	}
+	remoteMultiaddr, err := toQuicMultiaddr(qconn.RemoteAddr())
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{
+		qconn:           qconn,
+		transport:       l.transport,
+		localPeer:       l.transport.localPeer,
+		privKey:         l.transport.privKey,
+		localMultiaddr:  l.localMultiaddr,
+		remotePeerID:    remotePeerID,
+		remotePubKey:    remotePubKey,
+		remoteMultiaddr: remoteMultiaddr,
+	}, nil
+}
+
+func (l *listener) Close() error {
+	err := l.qlistener.Close()
+	if cerr := l.pconn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.qlistener.Addr()
+}
+
+func (l *listener) Multiaddr() ma.Multiaddr {
+	return l.localMultiaddr
+}
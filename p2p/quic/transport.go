@@ -0,0 +1,199 @@
+// Package quic implements libp2p QUIC transport on top of quic-go.
+//
+// Peers are authenticated by libp2p TLS handshake: the certificate presented by each side carries its libp2p public key
+// signed by the peer identity key, so any identity key type is supported.
+package quic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	tpt "github.com/libp2p/go-libp2p-core/transport"
+	p2ptls "github.com/libp2p/go-libp2p-tls"
+	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// alpn is the application protocol negotiated in TLS handshake of libp2p QUIC connections.
+const alpn = "libp2p"
+
+// ErrPrivateNetwork is returned when QUIC transport is constructed for private network: pre-shared key can't protect
+// QUIC connections, so the transport would allow connections from nodes outside of the network.
+var ErrPrivateNetwork = errors.New("QUIC transport does not support private networks")
+
+var quicConfig = &quicgo.Config{
+	MaxIncomingStreams:         1000,
+	MaxIncomingUniStreams:      -1,              // disable unidirectional streams
+	MaxStreamReceiveWindow:     3 * (1 << 20),   // 3 MB
+	MaxConnectionReceiveWindow: 4.5 * (1 << 20), // 4.5 MB
+	KeepAlivePeriod:            15 * time.Second,
+}
+
+// Transport is libp2p transport that dials and listens for QUIC connections.
+type Transport struct {
+	privKey   ic.PrivKey
+	localPeer peer.ID
+	identity  *p2ptls.Identity
+
+	mu      sync.Mutex
+	dialers map[string]*quicgo.Transport // by network
+}
+
+var _ tpt.Transport = (*Transport)(nil)
+
+// NewTransport creates QUIC transport for the node with the identity key. QUIC connections are secured and multiplexed
+// by QUIC itself, so upgrader is used only to find out whether node runs in private network, in which case the
+// transport fails with ErrPrivateNetwork.
+func NewTransport(key ic.PrivKey, upgrader *tptu.Upgrader) (*Transport, error) {
+	if upgrader != nil && upgrader.Protector != nil {
+		return nil, ErrPrivateNetwork
+	}
+	localPeer, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := p2ptls.NewIdentity(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transport{
+		privKey:   key,
+		localPeer: localPeer,
+		identity:  identity,
+		dialers:   make(map[string]*quicgo.Transport),
+	}, nil
+}
+
+// Dial dials QUIC connection to the peer and verifies that the remote side has the peer identity.
+func (t *Transport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (tpt.CapableConn, error) {
+	addr, err := fromQuicMultiaddr(raddr)
+	if err != nil {
+		return nil, err
+	}
+	network, _, err := manet.DialArgs(raddr)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := t.dialer(network)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf, keyCh := t.identity.ConfigForPeer(p)
+	tlsConf.NextProtos = []string{alpn}
+	qconn, err := dialer.Dial(ctx, addr, tlsConf, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var remotePubKey ic.PubKey
+	select {
+	case remotePubKey = <-keyCh:
+	default:
+	}
+	if remotePubKey == nil {
+		_ = qconn.CloseWithError(0, "")
+		return nil, errors.New("remote public key is not verified in handshake")
+	}
+
+	localMultiaddr, err := toQuicMultiaddr(qconn.LocalAddr())
+	if err != nil {
+		_ = qconn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	return &conn{
+		qconn:           qconn,
+		transport:       t,
+		localPeer:       t.localPeer,
+		privKey:         t.privKey,
+		localMultiaddr:  localMultiaddr,
+		remotePeerID:    p,
+		remotePubKey:    remotePubKey,
+		remoteMultiaddr: raddr,
+	}, nil
+}
+
+// dialer returns QUIC transport on the UDP socket all connections of the network are dialed from.
+func (t *Transport) dialer(network string) (*quicgo.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if d, ok := t.dialers[network]; ok {
+		return d, nil
+	}
+
+	var laddr *net.UDPAddr
+	switch network {
+	case "udp4":
+		laddr = &net.UDPAddr{IP: net.IPv4zero}
+	case "udp6":
+		laddr = &net.UDPAddr{IP: net.IPv6unspecified}
+	default:
+		return nil, fmt.Errorf("unsupported network: %v", network)
+	}
+	pconn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &quicgo.Transport{Conn: pconn}
+	t.dialers[network] = d
+	return d, nil
+}
+
+// CanDial returns true if the address is QUIC address over IPv4 or IPv6.
+func (t *Transport) CanDial(addr ma.Multiaddr) bool {
+	protocols := addr.Protocols()
+	if len(protocols) != 3 {
+		return false
+	}
+	switch protocols[0].Code {
+	case ma.P_IP4, ma.P_IP6:
+	default:
+		return false
+	}
+	return protocols[1].Code == ma.P_UDP && protocols[2].Code == ma.P_QUIC
+}
+
+// Listen listens for QUIC connections on the address.
+func (t *Transport) Listen(addr ma.Multiaddr) (tpt.Listener, error) {
+	return newListener(addr, t)
+}
+
+// Proxy returns false, QUIC transport connects to the peers directly.
+func (t *Transport) Proxy() bool {
+	return false
+}
+
+// Protocols returns the protocols handled by the transport.
+func (t *Transport) Protocols() []int {
+	return []int{ma.P_QUIC}
+}
+
+func (t *Transport) String() string {
+	return "QUIC"
+}
+
+var quicMultiaddr = ma.StringCast("/quic")
+
+func toQuicMultiaddr(addr net.Addr) (ma.Multiaddr, error) {
+	udpMultiaddr, err := manet.FromNetAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return udpMultiaddr.Encapsulate(quicMultiaddr), nil
+}
+
+func fromQuicMultiaddr(addr ma.Multiaddr) (net.Addr, error) {
+	return manet.ToNetAddr(addr.Decapsulate(quicMultiaddr))
+}
@@ -0,0 +1,155 @@
+package quic
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pnet "github.com/libp2p/go-libp2p-pnet"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const echoID = "/test/echo"
+
+// newQuicHost creates host with QUIC transport only, listening on random loopback port.
+func newQuicHost(t *testing.T, ctx context.Context, keyType int) host.Host {
+	t.Helper()
+
+	key, _, err := crypto.GenerateKeyPairWithReader(keyType, 2048, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := libp2p.New(ctx,
+		libp2p.Identity(key),
+		libp2p.Transport(NewTransport),
+		libp2p.ListenAddrs(ma.StringCast("/ip4/127.0.0.1/udp/0/quic")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType int
+	}{
+		{name: "ed25519", keyType: crypto.Ed25519},
+		{name: "secp256k1", keyType: crypto.Secp256k1},
+		{name: "rsa", keyType: crypto.RSA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			client, server := newQuicHost(t, ctx, tt.keyType), newQuicHost(t, ctx, tt.keyType)
+			defer func() { _ = client.Close() }()
+			defer func() { _ = server.Close() }()
+
+			server.SetStreamHandler(echoID, func(s network.Stream) {
+				defer func() { _ = s.Close() }()
+				_, _ = io.Copy(s, s)
+			})
+
+			if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+				t.Fatal(err)
+			}
+			conns := client.Network().ConnsToPeer(server.ID())
+			if len(conns) != 1 {
+				t.Fatalf("connections to server = %v, expected 1", len(conns))
+			}
+			if addr := conns[0].RemoteMultiaddr(); !strings.HasSuffix(addr.String(), "/quic") {
+				t.Errorf("remote address = %v, expected QUIC address", addr)
+			}
+			if !conns[0].RemotePublicKey().Equals(server.Peerstore().PubKey(server.ID())) {
+				t.Error("remote public key is not the server key")
+			}
+
+			s, err := client.NewStream(ctx, server.ID(), echoID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			// closing stream closes only write side, so the echo is still received
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			_ = s.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if b, err := ioutil.ReadAll(s); err != nil || string(b) != "ping" {
+				t.Errorf("echo = %q, %v, expected %q", b, err, "ping")
+			}
+		})
+	}
+}
+
+func TestTransportPeerMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, server, other := newQuicHost(t, ctx, crypto.Ed25519), newQuicHost(t, ctx, crypto.Ed25519), newQuicHost(t, ctx, crypto.Ed25519)
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+	defer func() { _ = other.Close() }()
+
+	// addresses of the server announced as addresses of other peer
+	if err := client.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: server.Addrs()}); err == nil {
+		t.Error("connected to the server as other peer")
+	}
+}
+
+func TestTransportPrivateNetwork(t *testing.T) {
+	psk, err := pnet.NewV1ProtectorFromBytes(&[32]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := libp2p.New(context.Background(),
+		libp2p.PrivateNetwork(psk),
+		libp2p.Transport(NewTransport),
+		libp2p.NoListenAddrs,
+	)
+	if err == nil {
+		_ = h.Close()
+		t.Fatal("QUIC transport is created for private network")
+	}
+	if !strings.Contains(err.Error(), ErrPrivateNetwork.Error()) {
+		t.Errorf("error = %v, expected %v", err, ErrPrivateNetwork)
+	}
+}
+
+func TestCanDial(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "/ip4/127.0.0.1/udp/4001/quic", want: true},
+		{addr: "/ip6/::1/udp/4001/quic", want: true},
+		{addr: "/ip4/127.0.0.1/udp/4001"},
+		{addr: "/ip4/127.0.0.1/tcp/4001"},
+		{addr: "/ip4/127.0.0.1/udp/4001/quic/ipfs/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC"},
+		{addr: "/dns4/example.com/udp/4001/quic"},
+	}
+
+	tr := &Transport{}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := tr.CanDial(ma.StringCast(tt.addr)); got != tt.want {
+				t.Errorf("CanDial(%v) = %v, expected %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
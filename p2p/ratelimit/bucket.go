@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket, where token is a single byte. Bucket is refilled at the rate of tokens per second and
+// holds at most burst tokens.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns full bucket that is refilled at the rate of bytes per second, the burst is equal to the rate.
+func NewBucket(rate int64) *Bucket {
+	return &Bucket{
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes can be transferred or context is done.
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	for n > 0 {
+		take := n
+		if float64(take) > b.burst {
+			take = int(b.burst)
+		}
+		n -= take
+
+		if d := b.reserve(take); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// reserve takes n tokens from the bucket and returns duration to wait until they are available.
+func (b *Bucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Buckets are token buckets that all must allow transfer, e.g. global, peer and session buckets.
+type Buckets []*Bucket
+
+// WaitN blocks until n bytes can be transferred by all buckets or context is done.
+func (bs Buckets) WaitN(ctx context.Context, n int) error {
+	for _, b := range bs {
+		if err := b.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitN returns duration of the rate limiter WaitN call.
+func waitN(t *testing.T, ctx context.Context, b RateLimiter, n int) (time.Duration, error) {
+	t.Helper()
+
+	start := time.Now()
+	err := b.WaitN(ctx, n)
+	return time.Since(start), err
+}
+
+func TestBucketWaitN(t *testing.T) {
+	const rate = 10000
+
+	tests := []struct {
+		name    string
+		drained bool // whole burst is taken before the measured WaitN
+		n       int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "burst", n: rate, max: 50 * time.Millisecond},
+		{name: "refill", drained: true, n: rate / 5, min: 150 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "larger than burst", n: rate + rate/5, min: 150 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "zero", drained: true, n: 0, max: 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := NewBucket(rate)
+			if tt.drained {
+				if err := b.WaitN(ctx, rate); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d, err := waitN(t, ctx, b, tt.n)
+			if err != nil {
+				t.Fatalf("WaitN(%v) failed: %v", tt.n, err)
+			}
+			if d < tt.min || d > tt.max {
+				t.Errorf("WaitN(%v) took %v, expected %v..%v", tt.n, d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBucketWaitNContextDone(t *testing.T) {
+	b := NewBucket(100)
+	if err := b.WaitN(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the bucket is refilled in a second, but context is done earlier
+	d, err := waitN(t, ctx, b, 100)
+	if err != context.DeadlineExceeded {
+		t.Errorf("WaitN error = %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if d > 500*time.Millisecond {
+		t.Errorf("WaitN returned in %v after context is done", d)
+	}
+}
+
+func TestBucketsWaitN(t *testing.T) {
+	fast, slow := NewBucket(100000), NewBucket(10000)
+	bs := Buckets{fast, slow}
+	if err := bs.WaitN(context.Background(), 10000); err != nil {
+		t.Fatal(err)
+	}
+
+	// the slowest bucket limits the rate
+	d, err := waitN(t, context.Background(), bs, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d < 150*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("WaitN took %v, expected about 200ms", d)
+	}
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Limits are bandwidth limits in bytes per second, zero means unlimited. Upload limits bytes sent to p2p streams,
+// download limits bytes received from them.
+type Limits struct {
+	Upload   int64
+	Download int64
+}
+
+// IsZero returns true if nothing is limited.
+func (l Limits) IsZero() bool {
+	return l.Upload <= 0 && l.Download <= 0
+}
+
+// RateLimiter waits until bytes can be transferred.
+type RateLimiter interface {
+	// WaitN blocks until n bytes can be transferred or context is done.
+	WaitN(ctx context.Context, n int) error
+}
+
+// WaitN waits for the rate limiter before transferring n bytes, nil rate limiter doesn't limit anything.
+func WaitN(ctx context.Context, l RateLimiter, n int) error {
+	if l == nil {
+		return nil
+	}
+	return l.WaitN(ctx, n)
+}
+
+// buckets are upload and download buckets of single scope.
+type buckets struct {
+	upload   *Bucket
+	download *Bucket
+}
+
+func newBuckets(l Limits) buckets {
+	var b buckets
+	if l.Upload > 0 {
+		b.upload = NewBucket(l.Upload)
+	}
+	if l.Download > 0 {
+		b.download = NewBucket(l.Download)
+	}
+	return b
+}
+
+// peerBuckets are buckets shared by all sessions with the peer.
+type peerBuckets struct {
+	buckets
+	sessions int
+}
+
+// Limiter limits bandwidth of all sessions (global), sessions with the same peer (per peer) and every session
+// separately (per session). Limiter can be shared by several forwarders and listeners.
+type Limiter struct {
+	global     buckets
+	perPeer    Limits
+	perSession Limits
+
+	mu    sync.Mutex
+	peers map[peer.ID]*peerBuckets
+}
+
+// New returns limiter with the given global, per peer and per session limits.
+func New(global, perPeer, perSession Limits) *Limiter {
+	return &Limiter{
+		global:     newBuckets(global),
+		perPeer:    perPeer,
+		perSession: perSession,
+		peers:      make(map[peer.ID]*peerBuckets),
+	}
+}
+
+// Session returns upload and download rate limiters of new session with the peer and function that must be called
+// when session is finished. Rate limiter of the direction is nil if the direction is not limited, so copy doesn't wait
+// for it at all. Nil limiter doesn't limit anything.
+func (l *Limiter) Session(p peer.ID) (upload, download RateLimiter, release func()) {
+	if l == nil {
+		return nil, nil, func() {}
+	}
+
+	session := newBuckets(l.perSession)
+	pb, releasePeer := l.peer(p)
+
+	upload = rateLimiter(l.global.upload, pb.upload, session.upload)
+	download = rateLimiter(l.global.download, pb.download, session.download)
+	return upload, download, releasePeer
+}
+
+// peer returns buckets of the peer and function that releases them.
+func (l *Limiter) peer(p peer.ID) (buckets, func()) {
+	if l.perPeer.IsZero() {
+		return buckets{}, func() {}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pb, ok := l.peers[p]
+	if !ok {
+		pb = &peerBuckets{buckets: newBuckets(l.perPeer)}
+		l.peers[p] = pb
+	}
+	pb.sessions++
+
+	var once sync.Once
+	return pb.buckets, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			if pb.sessions--; pb.sessions == 0 {
+				delete(l.peers, p)
+			}
+		})
+	}
+}
+
+// rateLimiter returns rate limiter that waits for all non-nil buckets, nil if there are no such buckets.
+func rateLimiter(buckets ...*Bucket) RateLimiter {
+	var bs Buckets
+	for _, b := range buckets {
+		if b != nil {
+			bs = append(bs, b)
+		}
+	}
+	if len(bs) == 0 {
+		return nil
+	}
+	return bs
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	alice = peer.ID("alice")
+	bob   = peer.ID("bob")
+)
+
+// sessionBuckets returns buckets of the rate limiter returned by Limiter.Session.
+func sessionBuckets(t *testing.T, l RateLimiter) Buckets {
+	t.Helper()
+
+	if l == nil {
+		return nil
+	}
+	bs, ok := l.(Buckets)
+	if !ok {
+		t.Fatalf("rate limiter %T is not Buckets", l)
+	}
+	return bs
+}
+
+func TestLimiterSession(t *testing.T) {
+	t.Run("nil limiter", func(t *testing.T) {
+		var l *Limiter
+		upload, download, release := l.Session(alice)
+		defer release()
+		if upload != nil || download != nil {
+			t.Errorf("Session() = %v, %v, expected nil rate limiters", upload, download)
+		}
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		l := New(Limits{}, Limits{}, Limits{})
+		upload, download, release := l.Session(alice)
+		defer release()
+		if upload != nil || download != nil {
+			t.Errorf("Session() = %v, %v, expected nil rate limiters", upload, download)
+		}
+	})
+
+	t.Run("single direction", func(t *testing.T) {
+		l := New(Limits{Upload: 1000}, Limits{}, Limits{})
+		upload, download, release := l.Session(alice)
+		defer release()
+		if len(sessionBuckets(t, upload)) != 1 || download != nil {
+			t.Errorf("Session() = %v, %v, expected only upload limited", upload, download)
+		}
+	})
+}
+
+func TestLimiterSessionComposition(t *testing.T) {
+	l := New(Limits{Upload: 1000}, Limits{Upload: 2000, Download: 2000}, Limits{Upload: 3000, Download: 3000})
+
+	aliceUp1, aliceDown1, release := l.Session(alice)
+	defer release()
+	aliceUp2, _, release := l.Session(alice)
+	defer release()
+	bobUp, _, release := l.Session(bob)
+	defer release()
+
+	a1, a2, b := sessionBuckets(t, aliceUp1), sessionBuckets(t, aliceUp2), sessionBuckets(t, bobUp)
+	if len(a1) != 3 || len(a2) != 3 || len(b) != 3 {
+		t.Fatalf("upload buckets = %v, %v, %v, expected global, peer and session buckets", len(a1), len(a2), len(b))
+	}
+	if a1[0] != a2[0] || a1[0] != b[0] {
+		t.Error("global bucket is not shared by all sessions")
+	}
+	if a1[1] != a2[1] {
+		t.Error("peer bucket is not shared by sessions with the peer")
+	}
+	if a1[1] == b[1] {
+		t.Error("peer bucket is shared by sessions with different peers")
+	}
+	if a1[2] == a2[2] {
+		t.Error("session bucket is shared by sessions")
+	}
+
+	// download is not limited globally
+	if d := sessionBuckets(t, aliceDown1); len(d) != 2 || d[0].rate != 2000 || d[1].rate != 3000 {
+		t.Errorf("download buckets = %v, expected peer and session buckets", d)
+	}
+}
+
+func TestLimiterPeerRelease(t *testing.T) {
+	l := New(Limits{}, Limits{Upload: 1000}, Limits{})
+
+	up1, _, release1 := l.Session(alice)
+	_, _, release2 := l.Session(alice)
+	if n := len(l.peers); n != 1 {
+		t.Fatalf("peers = %v, expected 1", n)
+	}
+
+	release1()
+	release1() // repeated release doesn't release other session
+	if pb, ok := l.peers[alice]; !ok || pb.sessions != 1 {
+		t.Fatalf("peer buckets are released while session is active: %+v, %v", pb, ok)
+	}
+
+	up2, _, release3 := l.Session(alice)
+	if sessionBuckets(t, up1)[0] != sessionBuckets(t, up2)[0] {
+		t.Error("new session of the peer gets other peer bucket while peer has active session")
+	}
+
+	release2()
+	release3()
+	if n := len(l.peers); n != 0 {
+		t.Errorf("peers = %v after all sessions are released, expected 0", n)
+	}
+
+	up3, _, release := l.Session(alice)
+	defer release()
+	if sessionBuckets(t, up1)[0] == sessionBuckets(t, up3)[0] {
+		t.Error("peer bucket is reused after it is released")
+	}
+}
+
+func TestLimiterNoPeerLimits(t *testing.T) {
+	l := New(Limits{Upload: 1000}, Limits{}, Limits{Upload: 1000})
+
+	_, _, release := l.Session(alice)
+	defer release()
+	if n := len(l.peers); n != 0 {
+		t.Errorf("peers = %v, expected no peer buckets without peer limits", n)
+	}
+}
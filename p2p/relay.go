@@ -0,0 +1,134 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/libp2p/go-libp2p"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// relayOptions returns libp2p options for NAT port mapping and circuit relay settings of the node config.
+func (n *Node) relayOptions() ([]libp2p.Option, error) {
+	cfg := &n.cfg
+
+	var opts []libp2p.Option
+	if !cfg.NoNATPortMap {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+
+	if cfg.NoRelay {
+		if cfg.RelayHop || cfg.RelayOnly || len(cfg.Relays) > 0 {
+			return nil, errors.New("relay is disabled, but relay options are specified")
+		}
+		return append(opts, libp2p.DisableRelay()), nil
+	}
+
+	var relayOpts []circuit.RelayOpt
+	if cfg.RelayHop {
+		relayOpts = append(relayOpts, circuit.OptHop)
+		if cfg.RelayHopLimit > 0 {
+			// limit is global in circuit package, but there is only one node per process
+			circuit.HopStreamLimit = cfg.RelayHopLimit
+		}
+	}
+	opts = append(opts, libp2p.EnableRelay(relayOpts...))
+
+	if cfg.RelayOnly {
+		if len(cfg.Relays) == 0 {
+			return nil, errors.New("relay-only mode requires at least one relay peer")
+		}
+		addrsFactory, err := relayOnlyAddrsFactory(cfg.Relays)
+		if err != nil {
+			return nil, err
+		}
+		// node announces static relay addresses, so auto relay is not used
+		return append(opts, libp2p.AddrsFactory(addrsFactory)), nil
+	}
+
+	if !cfg.NoAutoRelay {
+		opts = append(opts, libp2p.EnableAutoRelay())
+	}
+
+	return opts, nil
+}
+
+// relayOnlyAddrsFactory returns addresses factory that replaces node addresses with the circuit addresses through the
+// given relays.
+func relayOnlyAddrsFactory(relays []peer.AddrInfo) (func([]multiaddr.Multiaddr) []multiaddr.Multiaddr, error) {
+	var circuitAddrs []multiaddr.Multiaddr
+	for _, pi := range relays {
+		if len(pi.Addrs) == 0 {
+			return nil, fmt.Errorf("relay peer %v has no addresses", pi.ID)
+		}
+
+		circuitAddr, err := multiaddr.NewMultiaddr("/p2p/" + pi.ID.Pretty() + "/p2p-circuit")
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range pi.Addrs {
+			circuitAddrs = append(circuitAddrs, addr.Encapsulate(circuitAddr))
+		}
+	}
+
+	return func([]multiaddr.Multiaddr) []multiaddr.Multiaddr { return circuitAddrs }, nil
+}
+
+func (n *Node) keepRelayConnectionsAsync() {
+	relays := n.cfg.Relays
+	if len(relays) == 0 {
+		return
+	}
+
+	async.RunPeriodically(&n.wg, n.ctx, 30*time.Second, func(ctx context.Context) error {
+		EnsureConnectedToPeersWithTimeout(ctx, n.Host, relays, 10*time.Second)
+		for _, pi := range relays {
+			n.Host.ConnManager().TagPeer(pi.ID, "relay", 1)
+		}
+		return nil
+	})
+}
+
+// RelayStatus describes node connectivity through circuit relays.
+type RelayStatus struct {
+	RelayAddrs      int // number of announced circuit addresses
+	RelayedConns    int // number of connections through relays
+	RelaysConnected int // number of connected relays from node config
+}
+
+// RelayStatus returns node connectivity through circuit relays.
+func (n *Node) RelayStatus() RelayStatus {
+	var status RelayStatus
+	for _, addr := range n.Host.Addrs() {
+		if IsRelayAddr(addr) {
+			status.RelayAddrs++
+		}
+	}
+
+	nw := n.Host.Network()
+	for _, c := range nw.Conns() {
+		if IsRelayAddr(c.RemoteMultiaddr()) {
+			status.RelayedConns++
+		}
+	}
+
+	for _, pi := range n.cfg.Relays {
+		if nw.Connectedness(pi.ID) == network.Connected {
+			status.RelaysConnected++
+		}
+	}
+
+	return status
+}
+
+// IsRelayAddr returns true if the address is a circuit relay address.
+func IsRelayAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(circuit.P_CIRCUIT)
+	return err == nil
+}
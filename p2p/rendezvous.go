@@ -0,0 +1,46 @@
+package p2p
+
+import (
+	"context"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/libp2p/go-libp2p-core/discovery"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// advertiseRetryInterval is the interval between attempts to advertise rendezvous name if previous attempt failed,
+// e.g. because node is not connected to DHT yet.
+const advertiseRetryInterval = 30 * time.Second
+
+// Advertise persistently advertises node under the given rendezvous names using DHT until node is closed, so other
+// nodes can find it by name with FindPeers.
+func (n *Node) Advertise(rendezvous ...string) {
+	for _, ns := range rendezvous {
+		ns := ns
+		async.Run(&n.wg, func() { n.advertise(ns) })
+	}
+}
+
+func (n *Node) advertise(ns string) {
+	for {
+		wait := advertiseRetryInterval
+		if ttl, err := n.discovery.Advertise(n.ctx, ns); err != nil {
+			logger.Debugf("failed to advertise rendezvous %q: %v", ns, err)
+		} else {
+			logger.Debugf("advertised rendezvous %q", ns)
+			wait = 7 * ttl / 8
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// FindPeers implements discovery.Discoverer interface, it finds peers advertised under the given rendezvous name.
+func (n *Node) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	return n.discovery.FindPeers(ctx, ns, opts...)
+}
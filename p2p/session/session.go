@@ -0,0 +1,68 @@
+package session
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// lastID is the last session ID assigned, IDs are unique across all services of the process.
+var lastID uint64
+
+// Info describes single forwarded connection or UDP session.
+type Info struct {
+	ID        uint64    // unique session ID
+	Service   string    // service session belongs to
+	Peer      peer.ID   // remote peer
+	LocalAddr string    // local client address for forwarder, target address for listener, empty if unknown
+	Started   time.Time // session start time
+}
+
+// Sessions is a set of active sessions, zero value is ready to use.
+type Sessions struct {
+	mu       sync.Mutex
+	sessions map[uint64]Info
+}
+
+// Add adds new session, assigns its ID and start time, and returns function that removes the session.
+func (s *Sessions) Add(info Info) (remove func()) {
+	info.ID = atomic.AddUint64(&lastID, 1)
+	info.Started = time.Now()
+
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[uint64]Info)
+	}
+	s.sessions[info.ID] = info
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.sessions, info.ID)
+		s.mu.Unlock()
+	}
+}
+
+// List returns active sessions ordered by ID.
+func (s *Sessions) List() []Info {
+	s.mu.Lock()
+	res := make([]Info, 0, len(s.sessions))
+	for _, info := range s.sessions {
+		res = append(res, info)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// Len returns number of active sessions.
+func (s *Sessions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.sessions)
+}
@@ -0,0 +1,141 @@
+package socks5
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/armon/go-socks5"
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/libp2p/go-libp2p-core/network"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// DefaultBindTimeout is the default timeout bind request waits for inbound connection.
+const DefaultBindTimeout = time.Minute
+
+var errUnexpectedSource = errors.New("connection is not from the requested address")
+
+// serveBind listens for inbound connection from the destination, announces listen address with the first reply and
+// address of the inbound connection with the second one, then relays inbound connection to the stream.
+func (l *Socks5) serveBind(conn *countingConn, remote network.Stream, rules *peerRules, dest *socks5.AddrSpec) (p2p.CloseReason, error) {
+	if dest.FQDN != "" {
+		ip, err := rules.lookupIP(dest.FQDN)
+		if err != nil {
+			rules.dest = "bind " + dest.String()
+			return replyFailure(conn, hostUnreachable, err)
+		}
+		dest.IP = ip
+	}
+	rules.dest = "bind " + dest.String()
+
+	if err := rules.checkAccess(dest); err != nil {
+		logger.Warning(err)
+		rules.forbid()
+		_ = writeReply(conn, ruleFailure, nil, 0)
+		return "", err
+	}
+
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localIP(dest.IP)})
+	if err != nil {
+		return replyFailure(conn, serverFailure, err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	bindAddr := ln.Addr().(*net.TCPAddr)
+	if err := writeReply(conn, successReply, bindAddr.IP, bindAddr.Port); err != nil {
+		return "", err
+	}
+	logger.Debugf("peer %v bound %v for inbound connection from %v", &rules.clientPeer, bindAddr, dest)
+
+	inbound, err := l.acceptInbound(ln, rules, dest.IP)
+	if err != nil {
+		reason, err := replyFailure(conn, serverFailure, err)
+		if l.ctx.Err() != nil {
+			reason = p2p.Shutdown
+		}
+		return reason, err
+	}
+
+	from := inbound.RemoteAddr().(*net.TCPAddr)
+	if err := writeReply(conn, successReply, from.IP, from.Port); err != nil {
+		_ = inbound.Close()
+		return "", err
+	}
+	local, err := manet.WrapNetConn(inbound)
+	if err != nil {
+		_ = inbound.Close()
+		return "", err
+	}
+
+	res := p2p.FullDuplexCopy(l.ctx, local, remote, conn.copyOptions()...)
+	atomic.AddInt64(&conn.in, res.In)
+	atomic.AddInt64(&conn.out, res.Out)
+	return res.CloseReason, nil
+}
+
+// acceptInbound waits up to bind timeout for inbound connection from the IP address. If IP address is unspecified,
+// connection is accepted from any address the peer is allowed to access.
+func (l *Socks5) acceptInbound(ln *net.TCPListener, rules *peerRules, ip net.IP) (*net.TCPConn, error) {
+	timeout := l.bindTimeout
+	if timeout <= 0 {
+		timeout = DefaultBindTimeout
+	}
+	if err := ln.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	// listener is closed when service is closing
+	var wg sync.WaitGroup
+	accepted := make(chan struct{})
+	defer func() {
+		close(accepted)
+		wg.Wait()
+	}()
+	async.Run(&wg, func() {
+		select {
+		case <-l.ctx.Done():
+			_ = ln.Close()
+		case <-accepted:
+		}
+	})
+
+	for {
+		c, err := ln.AcceptTCP()
+		if err != nil {
+			return nil, err
+		}
+
+		from := c.RemoteAddr().(*net.TCPAddr)
+		if ip.IsUnspecified() {
+			err = rules.checkAccess(&socks5.AddrSpec{IP: from.IP, Port: from.Port})
+		} else if !ip.Equal(from.IP) {
+			err = errUnexpectedSource
+		}
+		if err != nil {
+			logger.Debugf("rejected inbound connection from %v: %v", from, err)
+			_ = c.Close()
+			continue
+		}
+		return c, nil
+	}
+}
+
+// localIP returns local IP address used to reach the IP address, nil is returned if it is unspecified or unreachable.
+func localIP(ip net.IP) net.IP {
+	if ip.IsUnspecified() {
+		return nil
+	}
+
+	// no packets are sent, connecting UDP socket only selects local address
+	c, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: 9})
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = c.Close() }()
+
+	return c.LocalAddr().(*net.UDPAddr).IP
+}
@@ -0,0 +1,201 @@
+package socks5
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+// newTestSocks5 starts socks5 service on one of mocked hosts and returns the other host authorized as client peer
+// with the targets.
+func newTestSocks5(t *testing.T, ctx context.Context, targets []string, rules ...string) host.Host {
+	t.Helper()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	destRules, err := acl.ParseDestinationRules(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPeers := acl.NewPeers(acl.Peer{AddrInfo: peer.AddrInfo{ID: hosts[0].ID()}, Targets: targets})
+	s, err := New(ctx, hosts[1], clientPeers,
+		WithDestinationRules(acl.NewDestinationRules(destRules...)),
+		WithBindTimeout(5*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = s.Close()
+	}()
+	return hosts[0]
+}
+
+// requestBind opens stream to socks5 service and sends BIND request for inbound connection from the IP address.
+func requestBind(t *testing.T, ctx context.Context, h host.Host, ip net.IP) (network.Stream, *bufio.Reader) {
+	t.Helper()
+
+	s, err := h.NewStream(ctx, h.Network().Peers()[0], ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(s)
+
+	if _, err := s.Write([]byte{socks5Version, 1, noAuth}); err != nil {
+		t.Fatal(err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(r, method); err != nil || method[1] != noAuth {
+		t.Fatalf("method selection = %v, %v", method, err)
+	}
+	if _, err := s.Write(appendAddr([]byte{socks5Version, 2, 0}, ip, 0)); err != nil {
+		t.Fatal(err)
+	}
+	return s, r
+}
+
+// readReply reads reply to socks5 request and returns reply code and bound address.
+func readReply(t *testing.T, r io.Reader) (uint8, *net.TCPAddr) {
+	t.Helper()
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	b, err := readAddr(r)
+	if err != nil {
+		t.Fatalf("failed to read reply address: %v", err)
+	}
+	addr, _, err := parseAddr(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header[1], &net.TCPAddr{IP: addr.IP, Port: addr.Port}
+}
+
+// dialFrom connects to the bound port on loopback address from the local IP address.
+func dialFrom(t *testing.T, from string, bound *net.TCPAddr) net.Conn {
+	t.Helper()
+
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(from)}, Timeout: 5 * time.Second}
+	c, err := d.Dial("tcp", (&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: bound.Port}).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// assertRejected asserts that inbound connection is closed without data.
+func assertRejected(t *testing.T, c net.Conn) {
+	t.Helper()
+
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := c.Read(make([]byte, 1)); err == nil || n != 0 {
+		t.Errorf("inbound connection from %v is not rejected: %v, %v", c.LocalAddr(), n, err)
+	}
+	_ = c.Close()
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name     string
+		targets  []string
+		rules    []string
+		bindIP   string
+		rejected []string // sources inbound connections from which are rejected before accepted one
+		from     string   // source of accepted inbound connection
+	}{
+		{name: "requested address", bindIP: "127.0.0.2", rejected: []string{"127.0.0.1"}, from: "127.0.0.2"},
+		{name: "any address", bindIP: "0.0.0.0", from: "127.0.0.1"},
+		{name: "any address denied by rule", bindIP: "0.0.0.0", rules: []string{"deny 127.0.0.3"}, rejected: []string{"127.0.0.3"}, from: "127.0.0.1"},
+		{name: "any address denied by targets", bindIP: "0.0.0.0", targets: []string{"0.0.0.0", "127.0.0.1"}, rejected: []string{"127.0.0.3"}, from: "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := newTestSocks5(t, ctx, tt.targets, tt.rules...)
+			s, r := requestBind(t, ctx, client, net.ParseIP(tt.bindIP))
+			defer func() { _ = s.Reset() }()
+
+			reply, bound := readReply(t, r)
+			if reply != successReply || bound.Port == 0 {
+				t.Fatalf("first reply = %v, %v, expected success with bound address", reply, bound)
+			}
+
+			for _, from := range tt.rejected {
+				assertRejected(t, dialFrom(t, from, bound))
+			}
+
+			inbound := dialFrom(t, tt.from, bound)
+			defer func() { _ = inbound.Close() }()
+
+			reply, source := readReply(t, r)
+			if reply != successReply || !source.IP.Equal(net.ParseIP(tt.from)) || source.Port != inbound.LocalAddr().(*net.TCPAddr).Port {
+				t.Fatalf("second reply = %v, %v, expected success with %v", reply, source, inbound.LocalAddr())
+			}
+
+			// inbound connection is relayed to the stream
+			if _, err := inbound.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "ping" {
+				t.Fatalf("stream received %q, %v", buf, err)
+			}
+			if _, err := s.Write([]byte("pong")); err != nil {
+				t.Fatal(err)
+			}
+			_ = inbound.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.ReadFull(inbound, buf); err != nil || string(buf) != "pong" {
+				t.Fatalf("inbound connection received %q, %v", buf, err)
+			}
+		})
+	}
+}
+
+func TestBindDenied(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		rules   []string
+	}{
+		{name: "destination rule", rules: []string{"deny 127.0.0.0/8"}},
+		{name: "peer targets", targets: []string{"example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := newTestSocks5(t, ctx, tt.targets, tt.rules...)
+			s, r := requestBind(t, ctx, client, net.ParseIP("127.0.0.1"))
+			defer func() { _ = s.Reset() }()
+
+			if reply, _ := readReply(t, r); reply != ruleFailure {
+				t.Errorf("reply = %v, expected %v", reply, ruleFailure)
+			}
+			if _, err := r.ReadByte(); err != io.EOF {
+				t.Errorf("stream is not closed after denied request: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package socks5
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/armon/go-socks5"
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/libp2p/go-libp2p-core/network"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// handshakeTimeout is how long forwarding of socks5 handshake can take.
+const handshakeTimeout = 30 * time.Second
+
+// ForwardConn forwards connection of local socks5 client to the stream of socks5 service. UDP associate requests are
+// served with local UDP relay: datagrams client sends to the relay are framed inside the stream until client closes
+// the connection. Other requests are forwarded as is. Handshake is interrupted if it times out or context is done.
+// Returns number of bytes copied in each direction and close reason.
+func ForwardConn(ctx context.Context, local manet.Conn, remote network.Stream, opts ...p2p.CopyOption) p2p.CopyResult {
+	h := &handshake{
+		local:      local,
+		remote:     remote,
+		fromLocal:  &handshakeReader{r: local},
+		fromRemote: &handshakeReader{r: remote},
+	}
+	relay, err := h.forwardWithDeadline(ctx)
+	if err != nil {
+		logger.Debugf("socks5 handshake with %v failed: %v", local.RemoteAddr(), err)
+		_ = local.Close()
+		_ = remote.Reset()
+		return p2p.CopyResult{In: h.in, Out: h.out, CloseReason: h.closeReason(ctx, err)}
+	}
+
+	var res p2p.CopyResult
+	if relay != nil {
+		res = forwardDatagrams(ctx, local, relay, remote, opts)
+	} else {
+		res = p2p.FullDuplexCopy(ctx, local, remote, opts...)
+	}
+	res.In += h.in
+	res.Out += h.out
+	return res
+}
+
+// forwardDatagrams copies datagrams between the relay and the stream until client closes the connection UDP associate
+// was requested on.
+func forwardDatagrams(ctx context.Context, local net.Conn, relay *clientRelay, remote network.Stream, opts []p2p.CopyOption) p2p.CopyResult {
+	logger.Debugf("relaying datagrams of %v on %v", local.RemoteAddr(), relay.LocalAddr())
+
+	var wg sync.WaitGroup
+	async.Run(&wg, func() {
+		_, _ = io.Copy(ioutil.Discard, local)
+		_ = relay.Close()
+	})
+
+	res := p2p.DatagramDuplexCopy(ctx, relay, remote, opts...)
+	_ = local.Close()
+	wg.Wait()
+	return res
+}
+
+// handshake forwards socks5 handshake of local client to the stream and intercepts UDP associate request.
+type handshake struct {
+	local                 net.Conn
+	remote                network.Stream
+	fromLocal, fromRemote *handshakeReader
+	in, out               int64 // bytes written to local client and to the stream
+}
+
+// forwardWithDeadline forwards handshake with deadline of handshake timeout, deadline is moved to now when context is
+// done and cleared after the handshake.
+func (h *handshake) forwardWithDeadline(ctx context.Context) (*clientRelay, error) {
+	h.setDeadline(time.Now().Add(handshakeTimeout))
+	defer h.setDeadline(time.Time{})
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	async.Run(&wg, func() {
+		select {
+		case <-ctx.Done():
+			h.setDeadline(time.Now())
+		case <-done:
+		}
+	})
+	defer wg.Wait()
+	defer close(done)
+
+	return h.forward()
+}
+
+func (h *handshake) setDeadline(t time.Time) {
+	_ = h.local.SetDeadline(t)
+	_ = h.remote.SetDeadline(t)
+}
+
+// forward forwards client greeting and request, it returns local UDP relay if UDP associate request succeeded.
+func (h *handshake) forward() (*clientRelay, error) {
+	greeting, err := readGreeting(h.fromLocal)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.writeRemote(greeting); err != nil || !acceptsNoAuth(greeting) {
+		return nil, err
+	}
+
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(h.fromRemote, method); err != nil {
+		return nil, err
+	}
+	if err := h.writeLocal(method); err != nil || method[1] != noAuth {
+		return nil, err
+	}
+
+	// request header: version, command and reserved byte
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(h.fromLocal, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socks5Version || header[1] != socks5.AssociateCommand {
+		return nil, h.writeRemote(header)
+	}
+	addr, err := readAddr(h.fromLocal)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.writeRemote(append(header, addr...)); err != nil {
+		return nil, err
+	}
+
+	// reply: version, reply code, reserved byte and bound address
+	reply := make([]byte, 3)
+	if _, err := io.ReadFull(h.fromRemote, reply); err != nil {
+		return nil, err
+	}
+	bindAddr, err := readAddr(h.fromRemote)
+	if err != nil {
+		return nil, err
+	}
+	if reply[1] != successReply {
+		return nil, h.writeLocal(append(reply, bindAddr...))
+	}
+
+	relay, err := listenClientRelay(h.local)
+	if err != nil {
+		_ = writeReply(h.local, serverFailure, nil, 0)
+		return nil, err
+	}
+	if err := h.writeLocal(appendAddr(reply, relay.addr.IP, relay.addr.Port)); err != nil {
+		_ = relay.Close()
+		return nil, err
+	}
+	return relay, nil
+}
+
+func (h *handshake) writeLocal(b []byte) error {
+	n, err := h.local.Write(b)
+	h.in += int64(n)
+	return err
+}
+
+func (h *handshake) writeRemote(b []byte) error {
+	n, err := h.remote.Write(b)
+	h.out += int64(n)
+	return err
+}
+
+// closeReason returns close reason of the session with failed handshake.
+func (h *handshake) closeReason(ctx context.Context, err error) p2p.CloseReason {
+	if ctx.Err() != nil {
+		return p2p.Shutdown
+	}
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		return p2p.IdleTimeout
+	}
+
+	switch {
+	case h.fromLocal.failed:
+		return p2p.LocalClosed
+	case h.fromRemote.failed:
+		return p2p.RemoteClosed
+	default:
+		return p2p.Error
+	}
+}
+
+// handshakeReader remembers whether reading failed.
+type handshakeReader struct {
+	r      io.Reader
+	failed bool
+}
+
+func (r *handshakeReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err != nil {
+		r.failed = true
+	}
+	return n, err
+}
+
+// clientRelay is local UDP relay socks5 client sends datagrams to. Datagrams are accepted only from IP address of the
+// client, datagrams from the stream are sent to the address client sent the last datagram from.
+type clientRelay struct {
+	*net.UDPConn
+	addr     *net.UDPAddr
+	clientIP net.IP // nil means any address, if client is connected over unix socket
+
+	mu     sync.Mutex
+	client *net.UDPAddr
+}
+
+// listenClientRelay starts UDP relay for the client connection on its local IP address.
+func listenClientRelay(local net.Conn) (*clientRelay, error) {
+	laddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	if addr, ok := local.LocalAddr().(*net.TCPAddr); ok {
+		laddr.IP = addr.IP
+	}
+
+	pc, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &clientRelay{UDPConn: pc, addr: pc.LocalAddr().(*net.UDPAddr)}
+	if addr, ok := local.RemoteAddr().(*net.TCPAddr); ok {
+		r.clientIP = addr.IP
+	}
+	return r, nil
+}
+
+// Read implements net.Conn interface, it receives single datagram from the client.
+func (r *clientRelay) Read(b []byte) (int, error) {
+	for {
+		n, from, err := r.ReadFromUDP(b)
+		if err != nil {
+			return 0, err
+		}
+		if r.clientIP != nil && !r.clientIP.Equal(from.IP) {
+			continue
+		}
+
+		r.mu.Lock()
+		r.client = from
+		r.mu.Unlock()
+		return n, nil
+	}
+}
+
+// Write implements net.Conn interface, it sends single datagram to the client, datagrams are dropped until client
+// sends the first one.
+func (r *clientRelay) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	client := r.client
+	r.mu.Unlock()
+
+	if client != nil {
+		if _, err := r.WriteToUDP(b, client); err != nil {
+			logger.Debugf("failed to send datagram to %v: %v", client, err)
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,64 @@
+package socks5
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+func TestForwardConnSilentClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	hosts[1].SetStreamHandler(ID, func(s network.Stream) {
+		<-ctx.Done()
+		_ = s.Reset()
+	})
+	remote, err := hosts[0].NewStream(ctx, hosts[1].ID(), ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := manet.Listen(multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	client, err := manet.Dial(ln.Multiaddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	local, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// client sends nothing, so handshake is interrupted only by the context
+	fwdCtx, fwdCancel := context.WithCancel(ctx)
+	resCh := make(chan p2p.CopyResult, 1)
+	go func() { resCh <- ForwardConn(fwdCtx, local, remote) }()
+
+	time.Sleep(50 * time.Millisecond)
+	fwdCancel()
+
+	select {
+	case res := <-resCh:
+		if res.CloseReason != p2p.Shutdown {
+			t.Errorf("close reason = %v, expected %v", res.CloseReason, p2p.Shutdown)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ForwardConn is not finished after context is done")
+	}
+}
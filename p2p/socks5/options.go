@@ -0,0 +1,81 @@
+package socks5
+
+import (
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/dns"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+)
+
+// Option configures Socks5.
+type Option func(s *Socks5)
+
+// WithAccessLog makes socks5 service write access log record for every session.
+func WithAccessLog(l *accesslog.Logger) Option {
+	return func(s *Socks5) {
+		s.accessLog = l
+	}
+}
+
+// WithBufferSize sets size of pooled buffers used to copy sessions data, p2p.DefaultBufferSize is used if size is not
+// positive.
+func WithBufferSize(size int) Option {
+	return func(s *Socks5) {
+		s.bufferSize = size
+	}
+}
+
+// WithDrainTimeout makes Close wait up to the timeout for active sessions to finish before their streams are reset.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(s *Socks5) {
+		s.drainTimeout = d
+	}
+}
+
+// WithDestinationRules makes socks5 service allow or deny requests by the destination rules, in addition to the
+// targets authorized peers are allowed to access.
+func WithDestinationRules(rules *acl.DestinationRules) Option {
+	return func(s *Socks5) {
+		s.destRules = rules
+	}
+}
+
+// WithResolver makes socks5 service resolve destination names with the resolver instead of system resolver.
+func WithResolver(r *dns.Resolver) Option {
+	return func(s *Socks5) {
+		s.resolver = r
+	}
+}
+
+// WithBindTimeout sets how long bind request waits for inbound connection, DefaultBindTimeout is used if timeout is not
+// positive.
+func WithBindTimeout(d time.Duration) Option {
+	return func(s *Socks5) {
+		s.bindTimeout = d
+	}
+}
+
+// WithRateLimiter makes socks5 service limit bandwidth of sessions with the limiter.
+func WithRateLimiter(rl *ratelimit.Limiter) Option {
+	return func(s *Socks5) {
+		s.rateLimiter = rl
+	}
+}
+
+// WithSessionLimits caps number of concurrent socks5 sessions and sessions of the same client peer.
+func WithSessionLimits(limits connlimit.Limits) Option {
+	return func(s *Socks5) {
+		s.sessionLimits = limits
+	}
+}
+
+// WithIdleTimeout sets timeout after which session without bytes transferred in any direction is closed, including
+// time BIND request waits for inbound connection, zero means no timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Socks5) {
+		s.idleTimeout = d
+	}
+}
@@ -0,0 +1,236 @@
+package socks5
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/armon/go-socks5"
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+const (
+	socks5Version = uint8(5)
+	noAuth        = uint8(0)
+
+	successReply    = uint8(0)
+	serverFailure   = uint8(1)
+	ruleFailure     = uint8(2)
+	hostUnreachable = uint8(4)
+	addrTypeError   = uint8(8)
+
+	addrTypeIPv4 = uint8(1)
+	addrTypeFQDN = uint8(3)
+	addrTypeIPv6 = uint8(4)
+)
+
+var errAddrType = errors.New("unsupported address type")
+
+// readGreeting reads client greeting: version, number of authentication methods and methods.
+func readGreeting(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socks5Version {
+		return header, nil
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return nil, err
+	}
+	return append(header, methods...), nil
+}
+
+// acceptsNoAuth returns true if client greeting offers no authentication method.
+func acceptsNoAuth(greeting []byte) bool {
+	if greeting[0] != socks5Version {
+		return false
+	}
+	for _, method := range greeting[2:] {
+		if method == noAuth {
+			return true
+		}
+	}
+	return false
+}
+
+// readAddr reads socks5 address (type, host and port) and returns its encoded bytes.
+func readAddr(r io.Reader) ([]byte, error) {
+	addr := make([]byte, 1, 1+1+255+2)
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return nil, err
+	}
+
+	var size int
+	switch addr[0] {
+	case addrTypeIPv4:
+		size = net.IPv4len
+	case addrTypeIPv6:
+		size = net.IPv6len
+	case addrTypeFQDN:
+		addr = addr[:2]
+		if _, err := io.ReadFull(r, addr[1:]); err != nil {
+			return nil, err
+		}
+		size = int(addr[1])
+	default:
+		return nil, errAddrType
+	}
+
+	start := len(addr)
+	addr = addr[:start+size+2]
+	if _, err := io.ReadFull(r, addr[start:]); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// parseAddr parses socks5 address at the beginning of b and returns it with its encoded size.
+func parseAddr(b []byte) (*socks5.AddrSpec, int, error) {
+	if len(b) < 1 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	addr := &socks5.AddrSpec{}
+	var size int
+	switch b[0] {
+	case addrTypeIPv4, addrTypeIPv6:
+		size = net.IPv4len
+		if b[0] == addrTypeIPv6 {
+			size = net.IPv6len
+		}
+		if len(b) < 1+size+2 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		addr.IP = append(net.IP(nil), b[1:1+size]...)
+		size++
+	case addrTypeFQDN:
+		if len(b) < 2 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		size = 2 + int(b[1])
+		if len(b) < size+2 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		addr.FQDN = string(b[2:size])
+	default:
+		return nil, 0, errAddrType
+	}
+
+	addr.Port = int(b[size])<<8 | int(b[size+1])
+	return addr, size + 2, nil
+}
+
+// appendAddr appends encoded socks5 address of the IP address and port.
+func appendAddr(b []byte, ip net.IP, port int) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		b = append(append(b, addrTypeIPv4), ip4...)
+	} else if ip16 := ip.To16(); ip16 != nil {
+		b = append(append(b, addrTypeIPv6), ip16...)
+	} else {
+		b = append(b, addrTypeIPv4, 0, 0, 0, 0)
+	}
+	return append(b, byte(port>>8), byte(port))
+}
+
+// writeReply writes reply to socks5 request with the bound address.
+func writeReply(w io.Writer, reply uint8, ip net.IP, port int) error {
+	_, err := w.Write(appendAddr([]byte{socks5Version, reply, 0}, ip, port))
+	return err
+}
+
+// replyFailure replies to socks5 request with the failure and closes the stream gracefully, so the client receives
+// the reply.
+func replyFailure(conn *countingConn, reply uint8, err error) (p2p.CloseReason, error) {
+	logger.Debugf("socks5 request failed: %v", err)
+	_ = writeReply(conn, reply, nil, 0)
+	_ = conn.Close()
+	return p2p.Error, err
+}
+
+// serveConn serves socks5 request over the connection to the stream. UDP associate and bind requests, which socks5
+// server doesn't support, are served by the service, other requests are replayed to socks5 server. Close reason is
+// returned only for the sessions finished by the service.
+func (l *Socks5) serveConn(s5 *socks5.Server, conn *countingConn, remote network.Stream, rules *peerRules) (p2p.CloseReason, error) {
+	greeting, err := readGreeting(conn)
+	if err != nil {
+		return "", err
+	}
+	if !acceptsNoAuth(greeting) {
+		return "", s5.ServeConn(newReplayConn(conn, greeting, 0))
+	}
+	if _, err := conn.Write([]byte{socks5Version, noAuth}); err != nil {
+		return "", err
+	}
+
+	// request header: version, command and reserved byte
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version || header[1] != socks5.AssociateCommand && header[1] != socks5.BindCommand {
+		// socks5 server writes method selection reply again, it is skipped
+		return "", s5.ServeConn(newReplayConn(conn, append(greeting, header...), 2))
+	}
+
+	addr, err := readAddr(conn)
+	if err != nil {
+		if err == errAddrType {
+			return replyFailure(conn, addrTypeError, err)
+		}
+		return "", err
+	}
+	if header[1] == socks5.BindCommand {
+		dest, _, err := parseAddr(addr)
+		if err != nil {
+			return "", err
+		}
+		return l.serveBind(conn, remote, rules, dest)
+	}
+	return l.serveAssociate(conn, remote, rules)
+}
+
+// replayConn replays bytes already read from the connection to socks5 server and skips bytes it writes that were
+// already written to the connection.
+type replayConn struct {
+	*countingConn
+	r    io.Reader
+	skip int
+}
+
+func newReplayConn(conn *countingConn, read []byte, written int) *replayConn {
+	return &replayConn{
+		countingConn: conn,
+		r:            io.MultiReader(bytes.NewReader(read), conn),
+		skip:         written,
+	}
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *replayConn) Write(b []byte) (int, error) {
+	skipped := c.skip
+	if skipped > len(b) {
+		skipped = len(b)
+	}
+	c.skip -= skipped
+
+	n, err := c.countingConn.Write(b[skipped:])
+	return skipped + n, err
+}
+
+// ReadFrom implements io.ReaderFrom interface
+func (c *replayConn) ReadFrom(r io.Reader) (int64, error) {
+	return p2p.CopyBuffered(c, r, c.bufferSize)
+}
+
+// WriteTo implements io.WriterTo interface
+func (c *replayConn) WriteTo(w io.Writer) (int64, error) {
+	return p2p.CopyBuffered(w, c, c.bufferSize)
+}
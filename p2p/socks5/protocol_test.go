@@ -0,0 +1,139 @@
+package socks5
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fqdnAddr returns encoded socks5 address of the domain name and port.
+func fqdnAddr(name string, port int) []byte {
+	return append(append([]byte{addrTypeFQDN, byte(len(name))}, name...), byte(port>>8), byte(port))
+}
+
+func TestReadAddr(t *testing.T) {
+	longName := strings.Repeat("a", 255)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "ipv4", input: []byte{addrTypeIPv4, 10, 0, 0, 1, 0, 80}, want: []byte{addrTypeIPv4, 10, 0, 0, 1, 0, 80}},
+		{name: "ipv6", input: appendAddr(nil, net.ParseIP("fd00::1"), 443), want: appendAddr(nil, net.ParseIP("fd00::1"), 443)},
+		{name: "fqdn", input: fqdnAddr("example.com", 80), want: fqdnAddr("example.com", 80)},
+		{name: "longest fqdn", input: fqdnAddr(longName, 80), want: fqdnAddr(longName, 80)},
+		{name: "trailing data is not read", input: append(fqdnAddr("example.com", 80), "payload"...), want: fqdnAddr("example.com", 80)},
+		{name: "empty", input: nil, wantErr: io.EOF},
+		{name: "truncated ipv4", input: []byte{addrTypeIPv4, 10, 0}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated ipv6", input: appendAddr(nil, net.ParseIP("fd00::1"), 443)[:10], wantErr: io.ErrUnexpectedEOF},
+		{name: "ipv4 without port", input: []byte{addrTypeIPv4, 10, 0, 0, 1}, wantErr: io.ErrUnexpectedEOF},
+		{name: "fqdn without length", input: []byte{addrTypeFQDN}, wantErr: io.EOF},
+		{name: "fqdn longer than data", input: []byte{addrTypeFQDN, 200, 'a', 'b', 'c', 0, 80}, wantErr: io.ErrUnexpectedEOF},
+		{name: "unsupported type", input: []byte{2, 10, 0, 0, 1, 0, 80}, wantErr: errAddrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAddr(bytes.NewReader(tt.input))
+			if err != tt.wantErr {
+				t.Fatalf("readAddr(%v) error = %v, expected %v", tt.input, err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("readAddr(%v) = %v, expected %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	longName := strings.Repeat("a", 255)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		ip      string
+		fqdn    string
+		port    int
+		size    int
+		wantErr error
+	}{
+		{name: "ipv4", input: []byte{addrTypeIPv4, 10, 0, 0, 1, 0x1f, 0x90}, ip: "10.0.0.1", port: 8080, size: 7},
+		{name: "ipv6", input: appendAddr(nil, net.ParseIP("fd00::1"), 443), ip: "fd00::1", port: 443, size: 19},
+		{name: "fqdn", input: fqdnAddr("example.com", 80), fqdn: "example.com", port: 80, size: 15},
+		{name: "longest fqdn", input: fqdnAddr(longName, 53), fqdn: longName, port: 53, size: 259},
+		{name: "trailing payload", input: append(fqdnAddr("example.com", 80), "payload"...), fqdn: "example.com", port: 80, size: 15},
+		{name: "empty", input: nil, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated ipv4", input: []byte{addrTypeIPv4, 10, 0, 0, 1, 0}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated ipv6", input: appendAddr(nil, net.ParseIP("fd00::1"), 443)[:18], wantErr: io.ErrUnexpectedEOF},
+		{name: "fqdn without length", input: []byte{addrTypeFQDN}, wantErr: io.ErrUnexpectedEOF},
+		{name: "fqdn longer than data", input: []byte{addrTypeFQDN, 255, 'a', 'b', 'c', 0, 80}, wantErr: io.ErrUnexpectedEOF},
+		{name: "fqdn without port", input: fqdnAddr("example.com", 80)[:14], wantErr: io.ErrUnexpectedEOF},
+		{name: "unsupported type", input: []byte{2, 10, 0, 0, 1, 0, 80}, wantErr: errAddrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, size, err := parseAddr(tt.input)
+			if err != tt.wantErr {
+				t.Fatalf("parseAddr(%v) error = %v, expected %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.ip != "" && !addr.IP.Equal(net.ParseIP(tt.ip)) || addr.FQDN != tt.fqdn || addr.Port != tt.port {
+				t.Errorf("parseAddr(%v) = %v, expected %v%v:%v", tt.input, addr, tt.ip, tt.fqdn, tt.port)
+			}
+			if size != tt.size {
+				t.Errorf("parseAddr(%v) size = %v, expected %v", tt.input, size, tt.size)
+			}
+		})
+	}
+}
+
+func TestParseDatagram(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		dest    string
+		payload string
+		wantErr bool
+	}{
+		{name: "ipv4", input: append([]byte{0, 0, 0, addrTypeIPv4, 10, 0, 0, 1, 0, 53}, "query"...), dest: "10.0.0.1:53", payload: "query"},
+		{name: "ipv6", input: append(appendAddr([]byte{0, 0, 0}, net.ParseIP("fd00::1"), 53), "query"...), dest: "[fd00::1]:53", payload: "query"},
+		{name: "fqdn", input: append(append([]byte{0, 0, 0}, fqdnAddr("example.com", 53)...), "query"...), dest: "example.com:53", payload: "query"},
+		{name: "empty payload", input: []byte{0, 0, 0, addrTypeIPv4, 10, 0, 0, 1, 0, 53}, dest: "10.0.0.1:53"},
+		{name: "fragment dropped", input: append([]byte{0, 0, 1, addrTypeIPv4, 10, 0, 0, 1, 0, 53}, "query"...), wantErr: true},
+		{name: "last fragment dropped", input: append([]byte{0, 0, 0x81, addrTypeIPv4, 10, 0, 0, 1, 0, 53}, "query"...), wantErr: true},
+		{name: "truncated header", input: []byte{0, 0}, wantErr: true},
+		{name: "truncated address", input: []byte{0, 0, 0, addrTypeIPv4, 10, 0}, wantErr: true},
+		{name: "fqdn longer than datagram", input: []byte{0, 0, 0, addrTypeFQDN, 100, 'a', 0, 53}, wantErr: true},
+		{name: "unsupported address type", input: []byte{0, 0, 0, 2, 10, 0, 0, 1, 0, 53}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, payload, err := parseDatagram(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDatagram(%v) = %v, %q, expected error", tt.input, dest, payload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDatagram(%v) failed: %v", tt.input, err)
+			}
+			host := dest.FQDN
+			if host == "" {
+				host = dest.IP.String()
+			}
+			if got := net.JoinHostPort(host, strconv.Itoa(dest.Port)); got != tt.dest || string(payload) != tt.payload {
+				t.Errorf("parseDatagram(%v) = %v, %q, expected %v, %q", tt.input, got, payload, tt.dest, tt.payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/armon/go-socks5"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/dns"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/metrics"
+)
+
+// peerRules allows socks5 requests only to the targets authorized peer is allowed to access and resolves their
+// destination names. Rules are created for every stream and remember requested destination.
+type peerRules struct {
+	ctx        context.Context // context of the service, returned for allowed requests
+	clientPeer acl.Peer
+	destRules  *acl.DestinationRules // destination rules applied to all peers
+	resolver   *dns.Resolver         // resolver of destination names
+	dest       string                // requested destination
+	denied     bool                  // request was denied
+	unresolved bool                  // destination name was not resolved
+}
+
+// Resolve implements socks5.NameResolver interface
+func (r *peerRules) Resolve(ctx context.Context, name string) (context.Context, net.IP, error) {
+	ip, err := r.lookupIP(name)
+	if err != nil {
+		logger.Warningf("peer %v failed to resolve %v: %v", &r.clientPeer, name, err)
+		r.dest = name
+		r.unresolved = true
+		return ctx, nil, err
+	}
+	return ctx, ip, nil
+}
+
+// lookupIP resolves the destination name. Names denied by destination rules regardless of the port and the address
+// are not resolved, so they don't cause DNS queries, nil IP is returned for them and access check denies the request.
+func (r *peerRules) lookupIP(name string) (net.IP, error) {
+	if denied, _ := r.destRules.NameDenied(r.clientPeer.ID, name); denied {
+		return nil, nil
+	}
+	return r.resolver.LookupIP(r.ctx, name)
+}
+
+// Allow implements socks5.RuleSet interface
+func (r *peerRules) Allow(ctx context.Context, req *socks5.Request) (context.Context, bool) {
+	r.dest = req.DestAddr.String()
+	if err := r.checkAccess(req.DestAddr); err != nil {
+		logger.Warning(err)
+		r.forbid()
+		return ctx, false
+	}
+	return r.ctx, true
+}
+
+// checkAccess returns error if the peer is not allowed to access the destination.
+func (r *peerRules) checkAccess(dest *socks5.AddrSpec) error {
+	if !r.clientPeer.CanAccess(destTargets(dest)...) {
+		return fmt.Errorf("peer %v is not allowed to access %v", &r.clientPeer, dest)
+	}
+
+	d := acl.Destination{FQDN: dest.FQDN, IP: dest.IP, Port: dest.Port}
+	if allowed, rule := r.destRules.Allowed(r.clientPeer.ID, d); !allowed {
+		return fmt.Errorf("peer %v is not allowed to access %v by destination rule: %v", &r.clientPeer, dest, rule)
+	}
+	return nil
+}
+
+// forbid marks the request as denied and counts it.
+func (r *peerRules) forbid() {
+	metrics.StreamOpenFailed(serviceName, metrics.Forbidden)
+	r.denied = true
+}
+
+// destTargets returns all target names the destination can be matched by: host:port and host, where host is either
+// domain name or IP address.
+func destTargets(dest *socks5.AddrSpec) []string {
+	port := strconv.Itoa(dest.Port)
+
+	var targets []string
+	if dest.FQDN != "" {
+		targets = append(targets, dest.FQDN+":"+port, dest.FQDN)
+	}
+	if len(dest.IP) != 0 {
+		ip := dest.IP.String()
+		targets = append(targets, ip+":"+port, ip)
+	}
+	return targets
+}
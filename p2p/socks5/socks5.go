@@ -2,23 +2,34 @@ package socks5
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-socks5"
 	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/accesslog"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/acl"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/connlimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/dns"
 	"github.com/dimchansky/go-p2p-forwarding/p2p/logging"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/metrics"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+	"github.com/dimchansky/go-p2p-forwarding/p2p/session"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
-	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/multiformats/go-multiaddr"
 )
 
 const ID = "/ipfs/port-forwarding-socks5/0.0.1"
 
+// serviceName is the service name used in sessions and metrics.
+const serviceName = "socks5"
+
 var logger = logging.Logger("socks5")
 
 type Socks5 struct {
@@ -28,38 +39,50 @@ type Socks5 struct {
 	wg        sync.WaitGroup
 
 	h              host.Host
-	s5             *socks5.Server
-	clientPeerAddr peer.AddrInfo
-}
+	clientPeers    *acl.Peers
+	sessions       session.Sessions
+	accessLog      *accesslog.Logger
+	rateLimiter    *ratelimit.Limiter
+	idleTimeout    time.Duration
+	sessionLimits  connlimit.Limits
+	sessionLimiter *connlimit.Limiter
+	bufferSize     int
+	destRules      *acl.DestinationRules
+	resolver       *dns.Resolver
 
-func New(ctx context.Context, h host.Host, clientAddr multiaddr.Multiaddr) (*Socks5, error) {
-	clientPeerAddr, err := peer.AddrInfoFromP2pAddr(clientAddr)
-	if err != nil {
-		return nil, err
-	}
-
-	s5, err := socks5.New(&socks5.Config{
-		Logger: log.New(ioutil.Discard, "", 0),
-	})
-	if err != nil {
-		return nil, err
-	}
+	bindTimeout  time.Duration
+	drainTimeout time.Duration
+	streamsMu    sync.Mutex
+	streams      map[network.Stream]struct{} // active streams
+	closing      bool                        // no new streams are accepted
+	drained      chan struct{}               // closed when there are no active streams after closing started
+}
 
+func New(ctx context.Context, h host.Host, clientPeers *acl.Peers, opts ...Option) (*Socks5, error) {
 	socksCtx, ctxCancel := context.WithCancel(ctx)
 	socks := &Socks5{
-		ctx:            socksCtx,
-		ctxCancel:      ctxCancel,
-		h:              h,
-		s5:             s5,
-		clientPeerAddr: *clientPeerAddr,
+		ctx:         socksCtx,
+		ctxCancel:   ctxCancel,
+		h:           h,
+		clientPeers: clientPeers,
+		streams:     make(map[network.Stream]struct{}),
 	}
+	for _, opt := range opts {
+		opt(socks)
+	}
+	socks.sessionLimiter = connlimit.New(socks.sessionLimits)
 	h.SetStreamHandler(ID, socks.handleStream)
 
-	socks.keepClientConnectionAsync()
+	socks.keepClientConnectionsAsync()
 
 	return socks, nil
 }
 
+// Sessions returns active socks5 sessions.
+func (l *Socks5) Sessions() []session.Info {
+	return l.sessions.List()
+}
+
 func (l *Socks5) Close() (err error) {
 	l.closeOnce.Do(func() {
 		err = l.close()
@@ -73,35 +96,355 @@ func (l *Socks5) close() error {
 
 	l.h.RemoveStreamHandler(ID)
 
-	// TODO: stop handling all socks5 requests
+	drained := l.stopAcceptingStreams()
+	if l.drainTimeout > 0 {
+		logger.Infof("waiting up to %v for active sessions to finish...", l.drainTimeout)
+		t := time.NewTimer(l.drainTimeout)
+		select {
+		case <-drained:
+		case <-t.C:
+		}
+		t.Stop()
+	}
 
 	l.ctxCancel()
+	l.resetStreams()
 	l.wg.Wait()
 
 	return nil
 }
 
+// addStream tracks the active stream, it returns false if service is closing and stream must be rejected.
+func (l *Socks5) addStream(s network.Stream) bool {
+	l.streamsMu.Lock()
+	defer l.streamsMu.Unlock()
+
+	if l.closing {
+		return false
+	}
+	l.streams[s] = struct{}{}
+	l.wg.Add(1)
+	return true
+}
+
+func (l *Socks5) removeStream(s network.Stream) {
+	l.streamsMu.Lock()
+	defer l.streamsMu.Unlock()
+
+	delete(l.streams, s)
+	if l.closing && len(l.streams) == 0 {
+		close(l.drained)
+	}
+	l.wg.Done()
+}
+
+// stopAcceptingStreams makes new streams rejected and returns channel that is closed when all active streams are
+// finished.
+func (l *Socks5) stopAcceptingStreams() <-chan struct{} {
+	l.streamsMu.Lock()
+	defer l.streamsMu.Unlock()
+
+	l.closing = true
+	l.drained = make(chan struct{})
+	if len(l.streams) == 0 {
+		close(l.drained)
+	}
+	return l.drained
+}
+
+// resetStreams resets all active streams, so their handlers are finished.
+func (l *Socks5) resetStreams() {
+	l.streamsMu.Lock()
+	defer l.streamsMu.Unlock()
+
+	if len(l.streams) > 0 {
+		logger.Infof("resetting %d active socks5 streams", len(l.streams))
+	}
+	for s := range l.streams {
+		_ = s.Reset()
+	}
+}
+
 func (l *Socks5) handleStream(remote network.Stream) {
+	if !l.addStream(remote) {
+		_ = remote.Reset()
+		return
+	}
+	defer l.removeStream(remote)
+
 	remoteConn := remote.Conn()
-	if remotePeerID := remoteConn.RemotePeer(); l.clientPeerAddr.ID != remotePeerID {
+	clientPeer, ok := l.clientPeers.Get(remoteConn.RemotePeer())
+	if !ok {
 		logger.Warningf("unauthorized peer rejected: %v (%v)", remoteConn.RemotePeer(), remoteConn.RemoteMultiaddr())
+		metrics.StreamOpenFailed(serviceName, metrics.Unauthorized)
+		_ = remote.Reset()
+		return
+	}
+
+	releaseSession, err := l.sessionLimiter.Acquire(l.ctx, clientPeer.ID)
+	if err != nil {
+		logger.Warningf("peer %v (%v) socks5 stream rejected: %v", &clientPeer, remoteConn.RemoteMultiaddr(), err)
+		metrics.StreamOpenFailed(serviceName, metrics.LimitExceeded)
 		_ = remote.Reset()
 		return
 	}
+	defer releaseSession()
 
-	// TODO: save remote stream to reset it on Close()
+	logger.Infof("peer %v (%v) opened socks5 stream", &clientPeer, remoteConn.RemoteMultiaddr())
+	defer logger.Debugf("peer %v (%v) socks5 stream closed.", &clientPeer, remoteConn.RemoteMultiaddr())
 
-	if err := l.s5.ServeConn(p2p.NewNetConn(remote)); err != nil {
+	defer metrics.SessionStarted(serviceName)()
+	defer l.sessions.Add(session.Info{Service: serviceName, Peer: clientPeer.ID})()
+
+	rules := &peerRules{ctx: l.ctx, clientPeer: clientPeer, destRules: l.destRules, resolver: l.resolver}
+	s5, err := newServer(rules)
+	if err != nil {
+		logger.Warningf("failed to create socks5 server: %v", err)
+		_ = remote.Reset()
+		return
+	}
+
+	upload, download, releaseRate := l.rateLimiter.Session(clientPeer.ID)
+	defer releaseRate()
+
+	start := time.Now()
+	countIn, countOut := metrics.ByteCounters(serviceName)
+	conn := &countingConn{
+		Conn:       p2p.NewNetConn(remote),
+		ctx:        l.ctx,
+		countIn:    countIn,
+		countOut:   countOut,
+		upload:     upload,
+		download:   download,
+		bufferSize: l.bufferSize,
+	}
+	stopWatching := conn.watchIdle(l.idleTimeout, remote)
+	reason, err := l.serveConn(s5, conn, remote, rules)
+	if stopWatching() {
+		reason = p2p.IdleTimeout
+	}
+	switch {
+	case reason != "":
+		// session is finished by copy of associate or bind request or by idle timeout
+	case rules.denied, rules.unresolved:
+		// close stream gracefully, so the client receives the reply
+		_ = conn.Close()
+	case err != nil:
 		logger.Debugf("socks5 serving error: %v", err)
 		_ = remote.Reset()
 	}
+
+	res := p2p.CopyResult{
+		In:          atomic.LoadInt64(&conn.in),
+		Out:         atomic.LoadInt64(&conn.out),
+		CloseReason: reason,
+	}
+	if res.CloseReason == "" {
+		res.CloseReason = closeReason(l.ctx, rules, conn, err)
+	}
+	r := accesslog.SessionRecord(serviceName, start, remoteConn, res)
+	r.Target = rules.dest
+	r.Protocol = ID
+	l.accessLog.Log(r)
+}
+
+// closeReason returns close reason of the session served by socks5 server with the rules over the connection.
+func closeReason(ctx context.Context, rules *peerRules, conn *countingConn, err error) p2p.CloseReason {
+	switch {
+	case ctx.Err() != nil:
+		return p2p.Shutdown
+	case rules.denied:
+		return p2p.Forbidden
+	case err == nil:
+		return p2p.Closed
+	case conn.readFailed():
+		// stream was closed or reset by remote peer
+		return p2p.RemoteClosed
+	default:
+		return p2p.Error
+	}
 }
 
-func (l *Socks5) keepClientConnectionAsync() {
+// newServer creates socks5 server that serves requests with the rules of the authorized client peer.
+func newServer(rules *peerRules) (*socks5.Server, error) {
+	var dialer net.Dialer
+	return socks5.New(&socks5.Config{
+		Rules:    rules,
+		Resolver: rules,
+		Dial:     dialer.DialContext, // context returned by the rules is done when service is closing
+		Logger:   log.New(ioutil.Discard, "", 0),
+	})
+}
+
+func (l *Socks5) keepClientConnectionsAsync() {
 	async.RunPeriodically(&l.wg, l.ctx, 5*time.Second, func(ctx context.Context) error {
-		if err := p2p.EnsureConnectedToPeerWithTimeout(ctx, l.h, l.clientPeerAddr, time.Second*30); err != nil {
-			logger.Debugf("failed to connect to client peer: %v", err)
+		p2p.EnsureConnectedToPeersWithTimeout(ctx, l.h, l.clientPeers.AddrInfos(), time.Second*30)
+		return nil
+	})
+}
+
+// countingConn accounts bytes read from p2p stream (in) and written to it (out) and limits their rate. It implements
+// io.ReaderFrom and io.WriterTo, so socks5 server copies data with pooled buffers.
+type countingConn struct {
+	net.Conn
+	ctx          context.Context
+	countIn      func(n int64)
+	countOut     func(n int64)
+	upload       ratelimit.RateLimiter // limits bytes written to p2p stream, nil if not limited
+	download     ratelimit.RateLimiter // limits bytes read from p2p stream, nil if not limited
+	in           int64                 // accessed atomically
+	out          int64                 // accessed atomically
+	readErr      int32                 // accessed atomically, 1 if reading from p2p stream failed
+	lastActivity int64                 // accessed atomically, unix time in nanoseconds of the last read or write
+	waiting      int32                 // accessed atomically, number of transfers waiting for rate limiters
+	bufferSize   int
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.AddInt64(&c.in, int64(n))
+		c.countIn(int64(n))
+		c.touch()
+		if wErr := c.waitN(c.ctx, c.download, n); wErr != nil && err == nil {
+			err = wErr
 		}
+	}
+	if err != nil {
+		atomic.StoreInt32(&c.readErr, 1)
+	}
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom interface
+func (c *countingConn) ReadFrom(r io.Reader) (int64, error) {
+	return p2p.CopyBuffered(c, r, c.bufferSize)
+}
+
+// WriteTo implements io.WriterTo interface
+func (c *countingConn) WriteTo(w io.Writer) (int64, error) {
+	return p2p.CopyBuffered(w, c, c.bufferSize)
+}
+
+// CloseWrite closes p2p stream for writing, so socks5 server propagates target EOF to the client.
+func (c *countingConn) CloseWrite() error {
+	if hc, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return hc.CloseWrite()
+	}
+	return nil
+}
+
+func (c *countingConn) readFailed() bool {
+	return atomic.LoadInt32(&c.readErr) == 1
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	if err := c.waitN(c.ctx, c.upload, len(b)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddInt64(&c.out, int64(n))
+		c.countOut(int64(n))
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *countingConn) touch() {
+	atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+}
+
+// waitN waits for the rate limiter, session is not idle while it waits.
+func (c *countingConn) waitN(ctx context.Context, l ratelimit.RateLimiter, n int) error {
+	if l == nil {
 		return nil
+	}
+
+	atomic.AddInt32(&c.waiting, 1)
+	defer func() {
+		c.touch()
+		atomic.AddInt32(&c.waiting, -1)
+	}()
+	return l.WaitN(ctx, n)
+}
+
+// connLimiter is a rate limiter of the copy that relays the session instead of the connection.
+type connLimiter struct {
+	c *countingConn
+	l ratelimit.RateLimiter
+}
+
+func (l connLimiter) WaitN(ctx context.Context, n int) error {
+	return l.c.waitN(ctx, l.l, n)
+}
+
+// copyOptions returns options of the copy that relays the session instead of the connection, copied bytes are
+// accounted as the connection ones.
+func (c *countingConn) copyOptions() []p2p.CopyOption {
+	countIn := func(n int64) {
+		c.countIn(n)
+		c.touch()
+	}
+	countOut := func(n int64) {
+		c.countOut(n)
+		c.touch()
+	}
+	var limitIn, limitOut p2p.RateLimiter
+	if c.download != nil {
+		limitIn = connLimiter{c: c, l: c.download}
+	}
+	if c.upload != nil {
+		limitOut = connLimiter{c: c, l: c.upload}
+	}
+	return []p2p.CopyOption{
+		p2p.WithByteCounters(countIn, countOut),
+		p2p.WithRateLimiters(limitIn, limitOut),
+		p2p.WithBufferSize(c.bufferSize),
+	}
+}
+
+// watchIdle resets the stream if nothing is read from or written to the connection during the timeout. Returned
+// function stops watching and returns true if the stream was reset.
+func (c *countingConn) watchIdle(timeout time.Duration, remote network.Stream) (stop func() bool) {
+	if timeout <= 0 {
+		return func() bool { return false }
+	}
+
+	c.touch()
+	var (
+		wg      sync.WaitGroup
+		expired int32
+		done    = make(chan struct{})
+	)
+	async.Run(&wg, func() {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				idleFor := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActivity)))
+				if atomic.LoadInt32(&c.waiting) > 0 {
+					t.Reset(timeout)
+					continue
+				}
+				if idleFor < timeout {
+					t.Reset(timeout - idleFor)
+					continue
+				}
+				atomic.StoreInt32(&expired, 1)
+				_ = remote.Reset()
+				return
+			case <-done:
+				return
+			}
+		}
 	})
+
+	return func() bool {
+		close(done)
+		wg.Wait()
+		return atomic.LoadInt32(&expired) == 1
+	}
 }
@@ -0,0 +1,131 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/armon/go-socks5"
+	"github.com/dimchansky/go-p2p-forwarding/p2p"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// UDP associate is served by the service itself, because socks5 server doesn't support it. After successful reply the
+// stream carries datagrams with socks5 UDP request header (RFC 1928) framed with p2p.WriteDatagram, so the forwarder
+// relays datagrams local client sends to its UDP relay.
+
+// maxDatagramHeaderSize is the maximum size of UDP request header with IP address: reserved (2 bytes), fragment
+// (1 byte), address type (1 byte), IPv6 address (16 bytes) and port (2 bytes).
+const maxDatagramHeaderSize = 3 + 1 + net.IPv6len + 2
+
+// parseDatagram parses datagram with socks5 UDP request header and returns its destination and payload.
+func parseDatagram(b []byte) (*socks5.AddrSpec, []byte, error) {
+	if len(b) < 3 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	if b[2] != 0 {
+		return nil, nil, fmt.Errorf("fragmented datagrams are not supported")
+	}
+
+	dest, size, err := parseAddr(b[3:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return dest, b[3+size:], nil
+}
+
+// serveAssociate relays datagrams framed inside the stream to their destinations and back.
+func (l *Socks5) serveAssociate(conn *countingConn, remote network.Stream, rules *peerRules) (p2p.CloseReason, error) {
+	rules.dest = "udp associate"
+
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return replyFailure(conn, serverFailure, err)
+	}
+	bindAddr := pc.LocalAddr().(*net.UDPAddr)
+	if err := writeReply(conn, successReply, bindAddr.IP, bindAddr.Port); err != nil {
+		_ = pc.Close()
+		return "", err
+	}
+
+	logger.Debugf("peer %v associated UDP relay %v", &rules.clientPeer, pc.LocalAddr())
+	relay := &udpRelay{UDPConn: pc, ctx: l.ctx, rules: rules, dests: make(map[string]struct{})}
+	res := p2p.DatagramDuplexCopy(l.ctx, relay, remote, conn.copyOptions()...)
+	atomic.AddInt64(&conn.in, res.In)
+	atomic.AddInt64(&conn.out, res.Out)
+	return res.CloseReason, nil
+}
+
+// udpRelay sends datagrams with socks5 UDP request header to their destinations and receives datagrams from them with
+// the header of the source address. Datagrams to the destinations peer is not allowed to access are dropped, as well as
+// datagrams from the addresses no datagram was sent to.
+type udpRelay struct {
+	*net.UDPConn
+	ctx   context.Context
+	rules *peerRules
+
+	mu    sync.Mutex
+	dests map[string]struct{} // addresses datagrams were sent to
+}
+
+// Write implements net.Conn interface, it sends single datagram with UDP request header.
+func (r *udpRelay) Write(b []byte) (int, error) {
+	dest, payload, err := parseDatagram(b)
+	if err != nil {
+		logger.Debugf("dropped invalid datagram of peer %v: %v", &r.rules.clientPeer, err)
+		return len(b), nil
+	}
+	if dest.FQDN != "" {
+		if dest.IP, err = r.rules.lookupIP(dest.FQDN); err != nil {
+			logger.Debugf("dropped datagram of peer %v: %v", &r.rules.clientPeer, err)
+			return len(b), nil
+		}
+	}
+	if err := r.rules.checkAccess(dest); err != nil {
+		logger.Debugf("dropped datagram: %v", err)
+		return len(b), nil
+	}
+
+	addr := &net.UDPAddr{IP: dest.IP, Port: dest.Port}
+	r.mu.Lock()
+	r.dests[addr.String()] = struct{}{}
+	r.mu.Unlock()
+
+	if _, err := r.WriteToUDP(payload, addr); err != nil {
+		logger.Debugf("failed to send datagram of peer %v to %v: %v", &r.rules.clientPeer, addr, err)
+	}
+	return len(b), nil
+}
+
+// Read implements net.Conn interface, it receives single datagram and prepends UDP request header to it.
+func (r *udpRelay) Read(b []byte) (int, error) {
+	if len(b) <= maxDatagramHeaderSize {
+		return 0, io.ErrShortBuffer
+	}
+
+	for {
+		n, from, err := r.ReadFromUDP(b[maxDatagramHeaderSize:])
+		if err != nil {
+			return 0, err
+		}
+		if !r.sentTo(from) {
+			continue
+		}
+
+		header := appendAddr(make([]byte, 3, maxDatagramHeaderSize), from.IP, from.Port)
+		copy(b[len(header):], b[maxDatagramHeaderSize:maxDatagramHeaderSize+n])
+		copy(b, header)
+		return len(header) + n, nil
+	}
+}
+
+func (r *udpRelay) sentTo(addr *net.UDPAddr) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.dests[addr.String()]
+	return ok
+}
@@ -2,7 +2,7 @@ package p2p
 
 import (
 	"context"
-	"io"
+	"net"
 	"sync"
 
 	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
@@ -10,30 +10,54 @@ import (
 	manet "github.com/multiformats/go-multiaddr-net"
 )
 
-// FullDuplexCopy copies bytes from local to remote and vice versa
-func FullDuplexCopy(ctx context.Context, local manet.Conn, remote network.Stream) {
+// FullDuplexCopy copies bytes from local to remote and vice versa. When one side finishes writing, its EOF is
+// propagated to the other side as half-close while the opposite direction drains, and the session is closed
+// gracefully when both directions are finished. Session is aborted if either direction fails, context is done or
+// session timeouts expire. Returns number of bytes copied in each direction and close reason.
+func FullDuplexCopy(ctx context.Context, local manet.Conn, remote network.Stream, opts ...CopyOption) (res CopyResult) {
+	cfg := newCopyConfig(opts)
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timeouts := newSessionTimeouts(cfg)
+	defer timeouts.stop()
 	var wg sync.WaitGroup
 
-	localRemoteCh := make(chan struct{})
+	localRemoteCh := make(chan bool, 1)
 	async.Run(&wg, func() {
-		defer close(localRemoteCh)
-		_, _ = io.Copy(local, remote)
+		w := newActivityWriter(newCountingWriter(local, cfg.countIn), timeouts)
+		var err error
+		res.In, err = CopyBuffered(newLimitingWriter(copyCtx, w, cfg.limitIn), remote, cfg.bufferSize)
+		localRemoteCh <- err == nil && closeWrite(local)
 	})
 
-	remoteLocalCh := make(chan struct{})
+	remoteLocalCh := make(chan bool, 1)
 	async.Run(&wg, func() {
-		defer close(remoteLocalCh)
-		_, _ = io.Copy(remote, local)
+		w := newActivityWriter(newCountingWriter(remote, cfg.countOut), timeouts)
+		var err error
+		res.Out, err = CopyBuffered(newLimitingWriter(copyCtx, w, cfg.limitOut), local, cfg.bufferSize)
+		// stream Close closes it only for writing
+		remoteLocalCh <- err == nil && remote.Close() == nil
 	})
 
-	select {
-	case <-localRemoteCh:
-	case <-remoteLocalCh:
-	case <-ctx.Done():
-	}
+	res.CloseReason = waitFinished(ctx, localRemoteCh, remoteLocalCh, timeouts)
 
+	cancel() // stops waiting for rate limiters
 	_ = local.Close()
-	_ = remote.Reset()
+	if res.CloseReason != Closed {
+		_ = remote.Reset()
+	}
 
 	wg.Wait()
+	return
+}
+
+// halfCloser is a connection that can be closed for writing.
+type halfCloser interface {
+	CloseWrite() error
+}
+
+// closeWrite closes the connection for writing, it returns false if the connection doesn't support half-close.
+func closeWrite(c net.Conn) bool {
+	hc, ok := c.(halfCloser)
+	return ok && hc.CloseWrite() == nil
 }
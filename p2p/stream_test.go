@@ -0,0 +1,293 @@
+package p2p
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dimchansky/go-p2p-forwarding/p2p/ratelimit"
+	"github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+const testProtocolID = "/test/copy/0.0.1"
+
+// testSession is FullDuplexCopy session between local TCP connection and p2p stream.
+type testSession struct {
+	client *net.TCPConn   // client end of local connection
+	peer   network.Stream // remote peer end of p2p stream
+	result chan CopyResult
+}
+
+// newTestSession starts FullDuplexCopy session with the options.
+func newTestSession(t *testing.T, ctx context.Context, opts ...CopyOption) *testSession {
+	t.Helper()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	peerCh := make(chan network.Stream, 1)
+	hosts[1].SetStreamHandler(testProtocolID, func(s network.Stream) { peerCh <- s })
+	remote, err := hosts[0].NewStream(ctx, hosts[1].ID(), testProtocolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := manet.Listen(multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testSession{client: client.(*net.TCPConn), result: make(chan CopyResult, 1)}
+	select {
+	case s.peer = <-peerCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream is not accepted by remote peer")
+	}
+	go func() { s.result <- FullDuplexCopy(ctx, local, remote, opts...) }()
+	return s
+}
+
+// wait waits until the session is finished.
+func (s *testSession) wait(t *testing.T) CopyResult {
+	t.Helper()
+
+	select {
+	case res := <-s.result:
+		return res
+	case <-time.After(5 * time.Second):
+		t.Fatal("session is not finished")
+		return CopyResult{}
+	}
+}
+
+// endpoint is an end of forwarding session that can be closed for writing.
+type endpoint struct {
+	name string
+	io.ReadWriter
+	closeWrite func() error
+}
+
+func (s *testSession) clientEndpoint() endpoint {
+	_ = s.client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return endpoint{name: "client", ReadWriter: s.client, closeWrite: s.client.CloseWrite}
+}
+
+func (s *testSession) peerEndpoint() endpoint {
+	// stream Close closes it only for writing
+	return endpoint{name: "peer", ReadWriter: s.peer, closeWrite: s.peer.Close}
+}
+
+func TestFullDuplexCopyHalfClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		localFirst  bool // local side closes for writing first
+		first, last string
+	}{
+		{name: "local closes first", localFirst: true, first: "request", last: "response"},
+		{name: "remote closes first", first: "greeting", last: "reply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newTestSession(t, ctx)
+			defer func() { _ = s.client.Close() }()
+
+			first, last := s.peerEndpoint(), s.clientEndpoint()
+			if tt.localFirst {
+				first, last = last, first
+			}
+
+			if _, err := first.Write([]byte(tt.first)); err != nil {
+				t.Fatal(err)
+			}
+			if err := first.closeWrite(); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := ioutil.ReadAll(last); err != nil || string(b) != tt.first {
+				t.Fatalf("%v received %q, %v, expected %q and EOF", last.name, b, err, tt.first)
+			}
+
+			// the other direction is still open after EOF is propagated
+			if _, err := last.Write([]byte(tt.last)); err != nil {
+				t.Fatalf("%v failed to write after half-close: %v", last.name, err)
+			}
+			if err := last.closeWrite(); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := ioutil.ReadAll(first); err != nil || string(b) != tt.last {
+				t.Fatalf("%v received %q, %v, expected %q and EOF", first.name, b, err, tt.last)
+			}
+
+			in, out := int64(len(tt.first)), int64(len(tt.last))
+			if tt.localFirst {
+				in, out = out, in
+			}
+			expected := CopyResult{In: in, Out: out, CloseReason: Closed}
+			if res := s.wait(t); res != expected {
+				t.Errorf("result = %+v, expected %+v", res, expected)
+			}
+		})
+	}
+}
+
+func TestFullDuplexCopyReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		halfClose bool // client closes for writing before reset
+		reset     func(s *testSession) error
+		expected  CloseReason
+	}{
+		{
+			name:     "remote reset",
+			reset:    func(s *testSession) error { return s.peer.Reset() },
+			expected: RemoteClosed,
+		},
+		{
+			name:      "remote reset after local half-close",
+			halfClose: true,
+			reset:     func(s *testSession) error { return s.peer.Reset() },
+			expected:  RemoteClosed,
+		},
+		{
+			name: "local reset",
+			reset: func(s *testSession) error {
+				// connection closed with zero linger is reset
+				if err := s.client.SetLinger(0); err != nil {
+					return err
+				}
+				return s.client.Close()
+			},
+			expected: LocalClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newTestSession(t, ctx)
+			defer func() { _ = s.client.Close() }()
+
+			if tt.halfClose {
+				if err := s.client.CloseWrite(); err != nil {
+					t.Fatal(err)
+				}
+				if b, err := ioutil.ReadAll(s.peer); err != nil || len(b) != 0 {
+					t.Fatalf("peer received %q, %v, expected EOF", b, err)
+				}
+			}
+			if err := tt.reset(s); err != nil {
+				t.Fatal(err)
+			}
+
+			if res := s.wait(t); res.CloseReason != tt.expected {
+				t.Errorf("close reason = %v, expected %v", res.CloseReason, tt.expected)
+			}
+			assertTornDown(t, s)
+		})
+	}
+}
+
+// assertTornDown asserts that both ends of finished session are closed: local connection is closed and p2p stream is
+// reset, so ends can't be mistaken for gracefully finished ones.
+func assertTornDown(t *testing.T, s *testSession) {
+	t.Helper()
+
+	_ = s.client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := s.client.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("client connection is not closed: %v, %v", n, err)
+	}
+	if n, err := s.peer.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("peer stream is not reset: %v, %v", n, err)
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// BenchmarkFullDuplexCopy benchmarks forwarding sessions over local TCP connection: local side sends the data and
+// closes for writing, remote peer discards it and closes the stream, so session is closed gracefully.
+func BenchmarkFullDuplexCopy(b *testing.B) {
+	tests := []struct {
+		name string
+		opts []CopyOption
+	}{
+		{name: "plain"},
+		{
+			name: "limited",
+			opts: []CopyOption{
+				// rate is high enough to never block, so the benchmark measures overhead of limiting writers
+				WithRateLimiters(ratelimit.NewBucket(1<<40), ratelimit.NewBucket(1<<40)),
+				WithIdleTimeout(time.Minute),
+				WithMaxLifetime(time.Hour),
+				WithByteCounters(func(int64) {}, func(int64) {}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		b.Run(tt.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			newStream := newStreamFactory(ctx, b)
+
+			ln, err := manet.Listen(multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() { _ = ln.Close() }()
+
+			b.SetBytes(sessionSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				client, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					b.Fatal(err)
+				}
+				local, err := ln.Accept()
+				if err != nil {
+					b.Fatal(err)
+				}
+				resCh := make(chan CopyResult, 1)
+				go func() { resCh <- FullDuplexCopy(ctx, local, newStream(), tt.opts...) }()
+
+				if _, err := CopyBuffered(client, io.LimitReader(zeroReader{}, sessionSize), 0); err != nil {
+					b.Fatal(err)
+				}
+				_ = client.(*net.TCPConn).CloseWrite()
+				_, _ = io.Copy(ioutil.Discard, client)
+				_ = client.Close()
+
+				if res := <-resCh; res.CloseReason != Closed || res.Out != sessionSize {
+					b.Fatalf("result = %+v, expected %v bytes out and %v", res, sessionSize, Closed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package strutil
+
+import "strings"
+
+// SplitList splits comma separated list skipping empty items, spaces around items are trimmed.
+func SplitList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package p2p
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	ipnet "github.com/libp2p/go-libp2p-core/pnet"
+	pnet "github.com/libp2p/go-libp2p-pnet"
+)
+
+// ReadSwarmKey reads private network pre-shared key from the file and creates protector of the connections.
+func ReadSwarmKey(path string) (ipnet.Protector, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return pnet.NewProtector(bytes.NewReader(key))
+}
+
+// GenerateSwarmKey generates new private network pre-shared key, writes it to the file and returns protector of the
+// connections.
+func GenerateSwarmKey(path string) (ipnet.Protector, error) {
+	r, err := pnet.GenerateV1PSK()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(path, key, 0400); err != nil {
+		return nil, err
+	}
+
+	return pnet.NewProtector(bytes.NewReader(key))
+}
@@ -0,0 +1,90 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// IsUnixAddr returns true if the address is a unix domain socket address.
+func IsUnixAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(multiaddr.P_UNIX)
+	return err == nil
+}
+
+// ListenUnix announces on the unix domain socket address. Stale socket file left by previous process is removed before
+// listening, permissions of the created socket file are set to `mode` (if not zero).
+func ListenUnix(addr multiaddr.Multiaddr, mode os.FileMode) (manet.Listener, error) {
+	path, err := addr.ValueForProtocol(multiaddr.P_UNIX)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeStaleUnixSocket(path); err != nil {
+		return nil, err
+	}
+
+	l, err := manet.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// CheckUnixSocket checks that the unix domain socket file either does not exist yet or is a socket.
+func CheckUnixSocket(addr multiaddr.Multiaddr) error {
+	path, err := addr.ValueForProtocol(multiaddr.P_UNIX)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Warningf("unix socket %v does not exist yet", path)
+			return nil
+		}
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v is not a unix socket", path)
+	}
+
+	return nil
+}
+
+// removeStaleUnixSocket removes socket file if nobody listens on it.
+func removeStaleUnixSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v already exists and is not a unix socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket %v is already in use", path)
+	}
+
+	logger.Infof("removing stale unix socket %v", path)
+	return os.Remove(path)
+}
@@ -2,8 +2,10 @@ package p2p
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/dimchansky/go-p2p-forwarding/p2p/async"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -41,3 +43,14 @@ func EnsureConnectedToPeerWithTimeout(ctx context.Context, h host.Host, targetPe
 
 	return EnsureConnectedToPeer(ctx2, h, targetPeerAddr)
 }
+
+// EnsureConnectedToPeersWithTimeout does the same as EnsureConnectedToPeerWithTimeout for every target peer concurrently
+// and waits until all connection attempts are finished.
+func EnsureConnectedToPeersWithTimeout(ctx context.Context, h host.Host, targetPeerAddrs []peer.AddrInfo, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, targetPeerAddr := range targetPeerAddrs {
+		targetPeerAddr := targetPeerAddr
+		async.Run(&wg, func() { _ = EnsureConnectedToPeerWithTimeout(ctx, h, targetPeerAddr, timeout) })
+	}
+	wg.Wait()
+}